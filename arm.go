@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Arm/disarm: while disarmed the app is read-only towards the mixer. The scheduler refuses every command
+// except panic ones, so no path can reach sendToSQ; editing state and shows still works. The switch is kept
+// in config.json ("armed"), so it survives restarts.
+
+var errDisarmed = errors.New("mixer writes are disarmed: arm the app to send to the mixer")
+
+// requireArmed answers 409 and returns false while disarmed.
+func requireArmed(c *gin.Context) bool {
+	if GetArmed() {
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": errDisarmed.Error(), "armed": false})
+	return false
+}
+
+func handleGetArmed(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"armed": GetArmed()})
+}
+
+// handlePostArmed sets the switch from {"armed": bool}; disarming also cancels a running sync.
+func handlePostArmed(c *gin.Context) {
+	var body struct {
+		Armed *bool `json:"armed"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Armed == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "need {\"armed\": true|false}"})
+		return
+	}
+	armed := *body.Armed
+	before := GetConfigSnapshot()
+	err := UpdateConfig(func(cf *config) { cf.Armed = &armed })
+	auditConfigChange("armed", before, GetConfigSnapshot(), auditOriginOf(c), err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	out := gin.H{"armed": armed}
+	if armed {
+		log.Printf("sqapi: ARMED, mixer writes enabled")
+	} else {
+		log.Printf("sqapi: DISARMED, mixer writes blocked")
+		if id := cancelSync(errDisarmed); id != "" {
+			out["cancelled_sync"] = id
+		}
+	}
+	c.JSON(http.StatusOK, out)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestDisarm(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	useTempDataDir(t)
+	// handlePostArmed writes config.json to the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	pace := 30
+	setTestConfig(t, func(c *config) { c.SyncPaceMS, c.PhantomSafety = &pace, &phantomSafety{} })
+	syncTestChannels(t, 12)
+	UpdateGain("local", 1, 40) // something to undo
+
+	frames := watchSim(t, v)
+	r := syncRouter(v)
+	getAddr := func(*gin.Context) (string, bool) { return v.Addr(), true }
+	r.POST("/api/armed", handlePostArmed)
+	r.POST("/api/state/undo", handleStateHistory(getAddr, true))
+	r.POST("/preamp/local/:id/phantom", func(c *gin.Context) { runPreampBool(c, getAddr, "local", parseLocalPreampID, buildPhantom, "phantom") })
+	r.POST("/preamp/local/:id/pad", func(c *gin.Context) { runPreampBool(c, getAddr, "local", parseLocalPreampID, buildPad, "pad") })
+	r.POST("/preamp/local/:id/gain", func(c *gin.Context) { runPreampGain(c, getAddr, "local", parseLocalPreampID, buildGain) })
+
+	postJSON(t, r, "/api/sync", `{}`, 202)
+	waitFor(t, func() bool { return len(frames()) >= 3 })
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/armed", strings.NewReader(`{"armed": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "cancelled_sync") {
+		t.Fatalf("disarm: %d %s", w.Code, w.Body)
+	}
+	if res := waitSyncResult(t); !res.Cancelled || len(res.Untouched) == 0 {
+		t.Errorf("sync result = %+v, want cancelled with untouched preamps", res)
+	}
+	sent := len(frames())
+
+	postJSON(t, r, "/preamp/local/2/phantom?on=1", ``, 409)
+	postJSON(t, r, "/preamp/local/2/pad?on=1", ``, 409)
+	postJSON(t, r, "/preamp/local/2/gain", `{"db": 30}`, 409)
+	postJSON(t, r, "/api/sync", `{}`, 409)
+	postJSON(t, r, "/api/state/undo?send=1", ``, 409)
+	cmd := mixerCmd{Addr: v.Addr(), Bus: "local", Preamp: 2, Param: "gain", Packet: buildGain(2, 30), Prio: prioInteractive}
+	if err := scheduler.Submit(cmd); !errors.Is(err, errDisarmed) {
+		t.Errorf("scheduler: %v, want errDisarmed", err)
+	}
+	if n := len(frames()); n != sent {
+		t.Fatalf("%d frames sent while disarmed", n-sent)
+	}
+
+	// The panic still reaches the mixer.
+	if results, _ := runPhantomPanic(v.Addr(), nil); !allConfirmed(results) {
+		t.Fatal("panic not confirmed while disarmed")
+	}
+	waitFor(t, func() bool { return len(frames()) > sent })
+	for _, f := range frames()[sent:] {
+		if !strings.HasSuffix(f, "phantom off") {
+			t.Errorf("%s sent while disarmed", f)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Crash-safe files: writes go to a temp file in the same directory, are fsynced and renamed over the target,
+// so a power cut leaves either the old or the new file. For state.json and config.json the previous version
+// is kept as <name>.bak (only if it was valid JSON); readFileRecover falls back to it when the primary file is
+// missing or corrupt and records the recovery for the API (/api/storage).
+
+// writeFileAtomic replaces path with b. With backup, a valid current file is first copied (atomically) to
+// path.bak, so there is never a moment without a primary file.
+func writeFileAtomic(path string, b []byte, perm os.FileMode, backup bool) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if backup {
+		// Copy, not move: the primary stays in place until the new file is renamed over it.
+		if cur, err := os.ReadFile(path); err == nil && json.Valid(cur) {
+			if err := writeFileAtomic(path+".bak", cur, perm, false); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir makes the renames in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		log.Printf("sqapi: fsync %s: %v", dir, err) // not supported everywhere; the rename itself is done
+	}
+	return nil
+}
+
+// storageRecovery is one fallback to a .bak file.
+type storageRecovery struct {
+	Time  time.Time `json:"time"`
+	File  string    `json:"file"`
+	Error string    `json:"error"` // what was wrong with the primary file
+}
+
+var (
+	recoveryMu sync.Mutex
+	recoveries []storageRecovery
+)
+
+// GetStorageRecoveries lists the recoveries since startup.
+func GetStorageRecoveries() []storageRecovery {
+	recoveryMu.Lock()
+	defer recoveryMu.Unlock()
+	return append([]storageRecovery(nil), recoveries...)
+}
+
+// readFileRecover reads a JSON file written by writeFileAtomic with backup. If path is missing or not valid
+// JSON but path.bak is good, the backup is restored as path and returned. Returns an os.IsNotExist error if
+// neither exists.
+func readFileRecover(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err == nil && json.Valid(b) {
+		return b, nil
+	}
+	problem := err
+	if err == nil {
+		problem = fmt.Errorf("corrupt JSON (%d bytes)", len(b))
+	}
+	bak, bakErr := os.ReadFile(path + ".bak")
+	if bakErr != nil || !json.Valid(bak) {
+		if err != nil {
+			return nil, err
+		}
+		return b, nil // let the caller report the parse error
+	}
+	log.Printf("sqapi: %s: %v, recovered from %s.bak", path, problem, path)
+	recoveryMu.Lock()
+	recoveries = append(recoveries, storageRecovery{Time: time.Now(), File: path, Error: problem.Error()})
+	recoveryMu.Unlock()
+	if err := writeFileAtomic(path, bak, 0644, false); err != nil {
+		log.Printf("sqapi: restore %s: %v", path, err)
+	}
+	return bak, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadFileRecover(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := writeFileAtomic(path, []byte(`{"v":1}`), 0644, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(path, []byte(`{"v":2}`), 0644, true); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path + ".bak"); string(b) != `{"v":1}` {
+		t.Fatalf("bak = %q", b)
+	}
+	// Truncated primary (power cut): fall back to the backup and restore the primary.
+	if err := os.WriteFile(path, []byte(`{"v":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	n := len(GetStorageRecoveries())
+	b, err := readFileRecover(path)
+	if err != nil || string(b) != `{"v":1}` {
+		t.Fatalf("recover = %q, %v", b, err)
+	}
+	if len(GetStorageRecoveries()) != n+1 {
+		t.Error("recovery not recorded")
+	}
+	if b, _ := os.ReadFile(path); string(b) != `{"v":1}` {
+		t.Errorf("primary not restored: %q", b)
+	}
+	if _, err := readFileRecover(filepath.Join(t.TempDir(), "missing.json")); !os.IsNotExist(err) {
+		t.Errorf("missing file: %v", err)
+	}
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Audit trail: every mixer command (from the scheduler, so sync, panic, ramps and undo are included), state
+// edit, show save/delete and config change is appended as one JSON line to audit.log in the data dir. The log
+// rotates at auditMaxBytes, keeping auditKeep old files (audit.log.1 is the newest). GET /api/audit filters
+// and exports them. Lines are written by one background goroutine, so callers (the scheduler loop above all)
+// never wait on the disk.
+
+const (
+	auditMaxBytes  = 5 << 20
+	auditKeep      = 3
+	auditQueueSize = 1024
+)
+
+// auditOrigin is who asked for a change: the endpoint and the client.
+type auditOrigin struct {
+	Source    string `json:"source"` // "POST /preamp/local/:id/gain"
+	ClientIP  string `json:"client_ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+func auditOriginOf(c *gin.Context) *auditOrigin {
+	return &auditOrigin{Source: c.Request.Method + " " + c.FullPath(), ClientIP: c.ClientIP(), UserAgent: c.Request.UserAgent()}
+}
+
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	Kind   string    `json:"kind"` // "mixer" | "state" | "show" | "config"
+	Action string    `json:"action"`
+	auditOrigin
+	Bus       string `json:"bus,omitempty"`
+	Preamp    int    `json:"preampId,omitempty"`
+	ChannelID int    `json:"channel_id,omitempty"`
+	Old       any    `json:"old,omitempty"`
+	New       any    `json:"new,omitempty"`
+	Result    string `json:"result"` // "ok" or the error
+}
+
+// auditWrite is one line for the writer; a flush request has no line, only done.
+type auditWrite struct {
+	path string
+	line []byte
+	done chan struct{}
+}
+
+var (
+	auditMu         sync.Mutex // serialises file access between the writer and readAudit
+	auditQueue      = make(chan auditWrite, auditQueueSize)
+	auditWriterOnce sync.Once
+)
+
+func auditPath() string { return filepath.Join(GetDataDir(), "audit.log") }
+
+// audit queues e; origin may be nil (internal changes). err is the outcome. If the writer is too far behind
+// the entry is dropped (and logged) rather than blocking the caller.
+func audit(e auditEntry, origin *auditOrigin, err error) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if origin != nil {
+		e.auditOrigin = *origin
+	}
+	e.Result = "ok"
+	if err != nil {
+		e.Result = err.Error()
+	}
+	b, merr := json.Marshal(e)
+	if merr != nil {
+		log.Printf("sqapi: audit: %v", merr)
+		return
+	}
+	auditWriterOnce.Do(func() { go runAuditWriter() })
+	select {
+	case auditQueue <- auditWrite{path: auditPath(), line: append(b, '\n')}:
+	default:
+		log.Printf("sqapi: audit queue full, dropped: %s", b)
+	}
+}
+
+func runAuditWriter() {
+	for w := range auditQueue {
+		if w.done != nil {
+			close(w.done)
+			continue
+		}
+		auditMu.Lock()
+		err := appendAuditLocked(w.path, w.line)
+		auditMu.Unlock()
+		if err != nil {
+			log.Printf("sqapi: audit: %v", err)
+		}
+	}
+}
+
+// flushAudit waits until every entry queued so far is written.
+func flushAudit() {
+	auditWriterOnce.Do(func() { go runAuditWriter() })
+	done := make(chan struct{})
+	auditQueue <- auditWrite{done: done}
+	<-done
+}
+
+func appendAuditLocked(path string, line []byte) error {
+	if fi, err := os.Stat(path); err == nil && fi.Size()+int64(len(line)) > auditMaxBytes {
+		for i := auditKeep - 1; i >= 1; i-- {
+			_ = os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1))
+		}
+		if err := os.Rename(path, path+".1"); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditMixerCmd records a command the scheduler sent (or failed to send). old is the mixer's last known value.
+func auditMixerCmd(cmd *mixerCmd, old string, err error) {
+	e := auditEntry{Kind: "mixer", Action: cmd.Param, Bus: cmd.Bus, Preamp: cmd.Preamp}
+	if old != "" {
+		e.Old = old
+	}
+	if f, perr := parseFrame(cmd.Packet); perr == nil {
+		e.New = f.value()
+	}
+	audit(e, cmd.Origin, err)
+}
+
+// mixerValue is the mixer's last known value for bus/preamp/param, or "".
+func mixerValue(bus string, preamp int, param string) string {
+	p, ok := GetMixerPreamp(bus, preamp)
+	if !ok {
+		return ""
+	}
+	switch {
+	case param == "phantom" && p.Phantom != nil:
+		return boolToOnOff(*p.Phantom)
+	case param == "pad" && p.Pad != nil:
+		return boolToOnOff(*p.Pad)
+	case param == "gain" && p.Gain != nil:
+		return fmt.Sprintf("%.0f dB", *p.Gain)
+	}
+	return ""
+}
+
+// auditChannels records one "state" entry per added, removed or changed channel.
+func auditChannels(action string, before, after []ChannelState, origin *auditOrigin, err error) {
+	old := map[int]ChannelState{}
+	for _, ch := range before {
+		old[ch.ID] = ch
+	}
+	for _, ch := range after {
+		o, ok := old[ch.ID]
+		delete(old, ch.ID)
+		switch {
+		case !ok:
+			audit(auditEntry{Kind: "state", Action: action, ChannelID: ch.ID, Bus: ch.PreampBus, Preamp: ch.PreampId, New: ch}, origin, err)
+		case !channelEqual(o, ch):
+			audit(auditEntry{Kind: "state", Action: action, ChannelID: ch.ID, Bus: ch.PreampBus, Preamp: ch.PreampId, Old: o, New: ch}, origin, err)
+		}
+	}
+	for _, ch := range before {
+		if o, ok := old[ch.ID]; ok {
+			audit(auditEntry{Kind: "state", Action: action, ChannelID: o.ID, Bus: o.PreampBus, Preamp: o.PreampId, Old: o}, origin, err)
+		}
+	}
+}
+
+func channelEqual(a, b ChannelState) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// auditFilter selects entries for GET /api/audit.
+type auditFilter struct {
+	From, To  time.Time
+	Bus       string
+	Preamp    int
+	ChannelID int
+	Kind      string
+}
+
+func (f auditFilter) match(e auditEntry) bool {
+	return (f.From.IsZero() || !e.Time.Before(f.From)) &&
+		(f.To.IsZero() || !e.Time.After(f.To)) &&
+		(f.Bus == "" || e.Bus == f.Bus) &&
+		(f.Preamp == 0 || e.Preamp == f.Preamp) &&
+		(f.ChannelID == 0 || e.ChannelID == f.ChannelID) &&
+		(f.Kind == "" || e.Kind == f.Kind)
+}
+
+// readAudit returns the matching entries from all audit files, oldest first, including everything queued.
+func readAudit(f auditFilter) ([]auditEntry, error) {
+	flushAudit()
+	auditMu.Lock()
+	defer auditMu.Unlock()
+	path := auditPath()
+	files := []string{}
+	for i := auditKeep; i >= 1; i-- {
+		files = append(files, fmt.Sprintf("%s.%d", path, i))
+	}
+	files = append(files, path)
+	out := []auditEntry{}
+	for _, name := range files {
+		fh, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sc := bufio.NewScanner(fh)
+		sc.Buffer(make([]byte, 64*1024), 1<<20)
+		for sc.Scan() {
+			var e auditEntry
+			if json.Unmarshal(sc.Bytes(), &e) == nil && f.match(e) {
+				out = append(out, e)
+			}
+		}
+		err = sc.Err()
+		fh.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// handleGetAudit serves GET /api/audit?from=&to= (RFC 3339) &bus=&preamp=&channel=&kind=&limit= (newest N).
+// format=csv or format=json downloads the result as a file.
+func handleGetAudit(c *gin.Context) {
+	var f auditFilter
+	for name, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := c.Query(name); v != "" {
+			var err error
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be RFC 3339, e.g. 2024-05-01T18:00:00Z"})
+				return
+			}
+		}
+	}
+	for name, n := range map[string]*int{"preamp": &f.Preamp, "channel": &f.ChannelID} {
+		if v := c.Query(name); v != "" {
+			var err error
+			if *n, err = strconv.Atoi(v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": name + " must be a number"})
+				return
+			}
+		}
+	}
+	f.Bus, f.Kind = c.Query("bus"), c.Query("kind")
+	entries, err := readAudit(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if v := c.Query("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 && n < len(entries) {
+			entries = entries[len(entries)-n:]
+		}
+	}
+	switch c.Query("format") {
+	case "csv":
+		c.Header("Content-Disposition", `attachment; filename="audit.csv"`)
+		c.Header("Content-Type", "text/csv")
+		c.Status(http.StatusOK)
+		writeAuditCSV(c.Writer, entries)
+	case "json":
+		c.Header("Content-Disposition", `attachment; filename="audit.json"`)
+		c.JSON(http.StatusOK, entries)
+	default:
+		c.JSON(http.StatusOK, gin.H{"entries": entries})
+	}
+}
+
+func writeAuditCSV(w http.ResponseWriter, entries []auditEntry) {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"time", "kind", "action", "source", "client_ip", "user_agent", "bus", "preamp", "channel", "old", "new", "result"})
+	value := func(v any) string {
+		if v == nil {
+			return ""
+		}
+		if s, ok := v.(string); ok {
+			return s
+		}
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	num := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	for _, e := range entries {
+		_ = cw.Write([]string{e.Time.Format(time.RFC3339Nano), e.Kind, e.Action, e.Source, e.ClientIP, e.UserAgent,
+			e.Bus, num(e.Preamp), num(e.ChannelID), value(e.Old), value(e.New), e.Result})
+	}
+	cw.Flush()
+}
+
+// auditConfigChange records a config change with only the fields that differ.
+func auditConfigChange(action string, before, after config, origin *auditOrigin, err error) {
+	var bm, am map[string]json.RawMessage
+	jb, _ := json.Marshal(before)
+	ja, _ := json.Marshal(after)
+	_ = json.Unmarshal(jb, &bm)
+	_ = json.Unmarshal(ja, &am)
+	old, new := map[string]json.RawMessage{}, map[string]json.RawMessage{}
+	for k, v := range am {
+		if string(bm[k]) != string(v) {
+			new[k] = v
+			if o, ok := bm[k]; ok {
+				old[k] = o
+			}
+		}
+	}
+	for k, v := range bm {
+		if _, ok := am[k]; !ok {
+			old[k] = v
+		}
+	}
+	if len(old)+len(new) == 0 && err == nil {
+		return
+	}
+	audit(auditEntry{Kind: "config", Action: action, Old: old, New: new}, origin, err)
+}
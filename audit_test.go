@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAuditFilter(t *testing.T) {
+	useTempDataDir(t)
+
+	origin := &auditOrigin{Source: "POST /preamp/slink/:id/phantom", ClientIP: "10.0.0.5"}
+	audit(auditEntry{Kind: "mixer", Action: "phantom", Bus: "slink", Preamp: 12, Old: "on", New: "off"}, origin, nil)
+	audit(auditEntry{Kind: "mixer", Action: "gain", Bus: "local", Preamp: 3, New: "20 dB"}, nil, errors.New("timeout"))
+	auditChannels("save state", nil, []ChannelState{{ID: 7, PreampBus: "slink", PreampId: 12}}, origin, nil)
+
+	got, err := readAudit(auditFilter{Bus: "slink", Preamp: 12, Kind: "mixer"})
+	if err != nil || len(got) != 1 {
+		t.Fatalf("got %+v, %v", got, err)
+	}
+	if e := got[0]; e.ClientIP != "10.0.0.5" || e.Old != "on" || e.New != "off" || e.Result != "ok" {
+		t.Errorf("entry = %+v", e)
+	}
+	if got, _ := readAudit(auditFilter{ChannelID: 7}); len(got) != 1 || got[0].Kind != "state" {
+		t.Errorf("channel filter: %+v", got)
+	}
+	if got, _ := readAudit(auditFilter{From: time.Now().Add(time.Minute)}); len(got) != 0 {
+		t.Errorf("from filter: %+v", got)
+	}
+	if got, _ := readAudit(auditFilter{Preamp: 3}); len(got) != 1 || got[0].Result != "timeout" {
+		t.Errorf("failed command: %+v", got)
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Channel CRUD: edit one channel without replacing the whole list (POST /api/state). The server assigns IDs,
+// the same normalizeAndValidateChannels rules apply, locked channels keep their preamp settings and every
+// change takes If-Match / "revision" like POST /api/state.
+
+var (
+	errChannelNotFound = errors.New("channel not found")
+	errChannelLocked   = errors.New("channel is locked: unlock it first")
+)
+
+// nextChannelID is one more than the highest ID in use.
+func nextChannelID(channels []ChannelState) int {
+	id := 0
+	for _, ch := range channels {
+		if ch.ID > id {
+			id = ch.ID
+		}
+	}
+	return id + 1
+}
+
+// assignChannelIDs gives every channel without an ID (0) the next free one, in list order.
+func assignChannelIDs(channels []ChannelState) []ChannelState {
+	for i := range channels {
+		if channels[i].ID == 0 {
+			channels[i].ID = nextChannelID(channels)
+		}
+	}
+	return channels
+}
+
+func channelIndex(channels []ChannelState, id int) int {
+	for i, ch := range channels {
+		if ch.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// lockedFieldsChanged reports whether b changes anything a lock protects on a.
+func lockedFieldsChanged(a, b ChannelState) bool {
+	k, _ := keepLockedChannels([]ChannelState{a}, []ChannelState{b})
+	return !channelEqual(k[0], b)
+}
+
+func parseChannelID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "channel id must be a number"})
+		return 0, false
+	}
+	return id, true
+}
+
+// editChannels runs one channel edit with the request's If-Match, audits it and answers status with the
+// result of pick (e.g. the changed channel), or with no body if pick is nil.
+func editChannels(c *gin.Context, status int, action string, revision *uint64, fn func([]ChannelState) ([]ChannelState, error), pick func([]ChannelState) any) {
+	ifRev, ok := ifMatchRevision(c, revision)
+	if !ok {
+		return
+	}
+	before, after, err := EditState(action, ifRev, fn)
+	var limitErr *limitError
+	switch {
+	case errors.Is(err, errRevisionConflict):
+		respondStateConflict(c)
+		return
+	case errors.Is(err, errChannelNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, errChannelLocked), errors.As(err, &limitErr):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if after == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	auditChannels(action, before, after, auditOriginOf(c), err)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	setStateETag(c, GetStateRevision())
+	if pick == nil {
+		c.Status(status)
+		return
+	}
+	c.JSON(status, pick(after))
+}
+
+func handleGetChannels(c *gin.Context) {
+	channels, _, rev := GetStateSnapshot()
+	setStateETag(c, rev)
+	c.JSON(http.StatusOK, gin.H{"channels": channels, "revision": rev})
+}
+
+func handleGetChannel(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	channels, _, rev := GetStateSnapshot()
+	i := channelIndex(channels, id)
+	if i < 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": errChannelNotFound.Error()})
+		return
+	}
+	setStateETag(c, rev)
+	c.JSON(http.StatusOK, channels[i])
+}
+
+// handlePostChannel appends a channel; the server assigns its ID (any id in the body is ignored).
+func handlePostChannel(c *gin.Context) {
+	var body struct {
+		ChannelState
+		Revision *uint64 `json:"revision"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ch := body.ChannelState
+	ch.Locked = false // locking is only done by /api/channels/:id/lock
+	editChannels(c, http.StatusCreated, "add channel", body.Revision, func(list []ChannelState) ([]ChannelState, error) {
+		ch.ID = nextChannelID(list)
+		return append(list, ch), nil
+	}, func(list []ChannelState) any { return list[channelIndex(list, ch.ID)] })
+}
+
+// handlePatchChannel changes the fields present in the JSON body (id and locked cannot be changed here).
+func handlePatchChannel(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	var patch map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var revision *uint64
+	if raw, ok := patch["revision"]; ok {
+		if err := json.Unmarshal(raw, &revision); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "revision must be a number"})
+			return
+		}
+	}
+	for _, k := range []string{"revision", "id", "locked"} {
+		delete(patch, k)
+	}
+	editChannels(c, http.StatusOK, fmt.Sprintf("edit channel %d", id), revision, func(list []ChannelState) ([]ChannelState, error) {
+		i := channelIndex(list, id)
+		if i < 0 {
+			return nil, errChannelNotFound
+		}
+		var merged map[string]json.RawMessage
+		b, _ := json.Marshal(list[i])
+		_ = json.Unmarshal(b, &merged)
+		for k, v := range patch {
+			merged[k] = v
+		}
+		b, _ = json.Marshal(merged)
+		var ch ChannelState
+		if err := json.Unmarshal(b, &ch); err != nil {
+			return nil, err
+		}
+		if list[i].Locked && lockedFieldsChanged(list[i], ch) {
+			return nil, errChannelLocked
+		}
+		list[i] = ch
+		return list, nil
+	}, func(list []ChannelState) any { return list[channelIndex(list, id)] })
+}
+
+func handleDeleteChannel(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	editChannels(c, http.StatusNoContent, fmt.Sprintf("delete channel %d", id), nil, func(list []ChannelState) ([]ChannelState, error) {
+		i := channelIndex(list, id)
+		if i < 0 {
+			return nil, errChannelNotFound
+		}
+		if list[i].Locked {
+			return nil, errChannelLocked
+		}
+		return append(list[:i], list[i+1:]...), nil
+	}, nil)
+}
+
+// handleMoveChannel moves a channel to {"position": n} (0-based, clamped to the list) in the display order.
+func handleMoveChannel(c *gin.Context) {
+	id, ok := parseChannelID(c)
+	if !ok {
+		return
+	}
+	var body struct {
+		Position *int    `json:"position"`
+		Revision *uint64 `json:"revision"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Position == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "need {\"position\": n}"})
+		return
+	}
+	editChannels(c, http.StatusOK, fmt.Sprintf("move channel %d", id), body.Revision, func(list []ChannelState) ([]ChannelState, error) {
+		i := channelIndex(list, id)
+		if i < 0 {
+			return nil, errChannelNotFound
+		}
+		ch := list[i]
+		list = append(list[:i], list[i+1:]...)
+		pos := min(max(*body.Position, 0), len(list))
+		list = append(list[:pos], append([]ChannelState{ch}, list[pos:]...)...)
+		return list, nil
+	}, func(list []ChannelState) any { return gin.H{"channels": list} })
+}
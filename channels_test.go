@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestChannelCRUD(t *testing.T) {
+	useTempDataDir(t)
+	if err := SetStateAndCurrentShow([]ChannelState{{ID: 4, PreampBus: "local", PreampId: 17, Locked: true}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/channels", handlePostChannel)
+	r.PATCH("/api/channels/:id", handlePatchChannel)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("POST", "/api/channels", `{"id": 1, "name": "Kick", "preampBus": "slink", "preampId": 1}`)
+	var ch ChannelState
+	if w.Code != http.StatusCreated || json.Unmarshal(w.Body.Bytes(), &ch) != nil || ch.ID != 5 {
+		t.Fatalf("create: %d %s", w.Code, w.Body)
+	}
+	if w := do("PATCH", "/api/channels/5", `{"gain": 24}`); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"name":"Kick"`) {
+		t.Errorf("patch: %d %s", w.Code, w.Body)
+	}
+	if w := do("PATCH", "/api/channels/5", `{"preampId": 41}`); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid patch: %d %s", w.Code, w.Body)
+	}
+	if w := do("PATCH", "/api/channels/4", `{"gain": 30}`); w.Code != http.StatusConflict {
+		t.Errorf("locked patch: %d %s", w.Code, w.Body)
+	}
+	if w := do("PATCH", "/api/channels/9", `{"gain": 30}`); w.Code != http.StatusNotFound {
+		t.Errorf("missing channel: %d %s", w.Code, w.Body)
+	}
+}
+
+func TestAssignChannelIDs(t *testing.T) {
+	got := assignChannelIDs([]ChannelState{{ID: 0}, {ID: 7}, {ID: 0}})
+	if got[0].ID != 8 || got[1].ID != 7 || got[2].ID != 9 {
+		t.Errorf("ids = %d %d %d, want 8 7 9", got[0].ID, got[1].ID, got[2].ID)
+	}
+}
@@ -2,88 +2,180 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-// syncStatus holds progress and result of the background sync.
-var (
-	syncMu         sync.Mutex
-	syncStatus     string      // "idle" | "running"
-	syncCurrent    int         // 0-based index of current channel
-	syncTotal      int         // total channels
-	syncLastResult *syncResult // set when status becomes "idle"
-)
-
-type syncResult struct {
-	Synced int    `json:"synced,omitempty"`
-	Error  string `json:"error,omitempty"`
-}
-
 func handleGetConfig(c *gin.Context) {
 	sqip, dataDirOut, err := LoadConfig()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"sq_ip": sqip, "data_dir": dataDirOut})
+	c.JSON(http.StatusOK, gin.H{"sq_ip": sqip, "data_dir": dataDirOut, "sync_pace_ms": GetSyncPace().Milliseconds(), "phantom_safety": GetPhantomSafety(), "unused_defaults": GetUnusedDefaults()})
 }
 
 func handlePostConfig(c *gin.Context) {
 	var body struct {
-		SQIP    string `json:"sq_ip"`
-		DataDir string `json:"data_dir"`
+		SQIP       string `json:"sq_ip"`
+		DataDir    string `json:"data_dir"`
+		SyncPaceMS *int   `json:"sync_pace_ms"`
+
+		PhantomSafety  *phantomSafety  `json:"phantom_safety"`
+		UnusedDefaults *preampDefaults `json:"unused_defaults"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if body.SyncPaceMS != nil && (*body.SyncPaceMS < 0 || *body.SyncPaceMS > 5000) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sync_pace_ms must be 0..5000"})
+		return
+	}
+	if body.PhantomSafety != nil {
+		if err := body.PhantomSafety.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if body.UnusedDefaults != nil && (body.UnusedDefaults.Gain < gainDBMin || body.UnusedDefaults.Gain > gainDBMax) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("unused_defaults.gain must be %d..%d", gainDBMin, gainDBMax)})
+		return
+	}
 	dir := strings.TrimSpace(body.DataDir)
+	before := GetConfigSnapshot()
+	// Pending preamp updates belong to the current data dir.
+	if err := FlushState(); err != nil {
+		log.Printf("sqapi: flush state before config save: %v", err)
+	}
 	if err := SaveConfig(strings.TrimSpace(body.SQIP), dir); err != nil {
+		auditConfigChange("save config", before, GetConfigSnapshot(), auditOriginOf(c), err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	if body.SyncPaceMS != nil || body.PhantomSafety != nil || body.UnusedDefaults != nil {
+		err := UpdateConfig(func(cf *config) {
+			if body.SyncPaceMS != nil {
+				cf.SyncPaceMS = body.SyncPaceMS
+			}
+			if body.PhantomSafety != nil {
+				cf.PhantomSafety = body.PhantomSafety
+			}
+			if body.UnusedDefaults != nil {
+				cf.UnusedDefaults = body.UnusedDefaults
+			}
+		})
+		if err != nil {
+			auditConfigChange("save config", before, GetConfigSnapshot(), auditOriginOf(c), err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	auditConfigChange("save config", before, GetConfigSnapshot(), auditOriginOf(c), nil)
+	mixer.SetAddr(sqAddr(strings.TrimSpace(body.SQIP)))
 	// Reload state from (possibly new) data dir
 	if err := LoadState(); err != nil {
 		log.Printf("sqapi: reload state after config save: %v", err)
 	}
-	c.JSON(http.StatusOK, gin.H{"sq_ip": strings.TrimSpace(body.SQIP), "data_dir": GetDataDir()})
+	c.JSON(http.StatusOK, gin.H{"sq_ip": strings.TrimSpace(body.SQIP), "data_dir": GetDataDir(), "sync_pace_ms": GetSyncPace().Milliseconds(), "phantom_safety": GetPhantomSafety(), "unused_defaults": GetUnusedDefaults()})
 }
 
 func handleGetState(c *gin.Context) {
 	sqip, _, _ := LoadConfig()
-	channels := GetState()
-	currentShow := GetCurrentShow()
-	c.JSON(http.StatusOK, gin.H{"channels": channels, "sq_ip": sqip, "current_show": currentShow, "line_preamp_ids": localLinePreampIDs})
+	channels, currentShow, rev := GetStateSnapshot()
+	setStateETag(c, rev)
+	out := gin.H{"channels": channels, "sq_ip": sqip, "current_show": currentShow, "line_preamp_ids": localLinePreampIDs, "armed": GetArmed(), "revision": rev}
+	if r := GetStorageRecoveries(); len(r) > 0 {
+		out["storage_recoveries"] = r
+	}
+	if e := GetPersistError(); e != nil {
+		out["persist_error"] = e
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func setStateETag(c *gin.Context, rev uint64) {
+	c.Header("ETag", fmt.Sprintf("%q", strconv.FormatUint(rev, 10)))
+}
+
+// ifMatchRevision returns the revision the client based its edit on: the If-Match header ("12", W/"12"; * = any)
+// or else the body's revision. nil = unconditional.
+func ifMatchRevision(c *gin.Context, body *uint64) (*uint64, bool) {
+	h := strings.TrimSpace(c.GetHeader("If-Match"))
+	switch h {
+	case "":
+		return body, true
+	case "*":
+		return nil, true
+	}
+	rev, err := strconv.ParseUint(strings.Trim(strings.TrimPrefix(h, "W/"), `"`), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "If-Match must be a state revision from the ETag of /api/state"})
+		return nil, false
+	}
+	return &rev, true
 }
 
+// respondStateConflict answers 409 with the current state, so the client can merge and retry.
+func respondStateConflict(c *gin.Context) {
+	channels, currentShow, rev := GetStateSnapshot()
+	setStateETag(c, rev)
+	c.JSON(http.StatusConflict, gin.H{"error": errRevisionConflict.Error(), "channels": channels, "current_show": currentShow, "revision": rev})
+}
+
+// handlePostState replaces the channel list; channels without an id get one from the server (show loads).
+// With If-Match or "revision" the write only happens if the state is still at that revision (409 with the
+// current state otherwise).
 func handlePostState(c *gin.Context) {
 	var body struct {
 		Channels    []ChannelState `json:"channels"`
 		SqIP        string         `json:"sq_ip"`
 		CurrentShow *string        `json:"current_show"`
+		Revision    *uint64        `json:"revision"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	ifRev, ok := ifMatchRevision(c, body.Revision)
+	if !ok {
+		return
+	}
+	if ifRev != nil && *ifRev != GetStateRevision() {
+		respondStateConflict(c)
+		return
+	}
 	if body.Channels == nil {
 		body.Channels = []ChannelState{}
 	}
-	channels, err := normalizeAndValidateChannels(body.Channels)
+	// Locked channels keep their current preamp settings, whatever the client (or a loaded show) sends.
+	prev := GetState()
+	in, kept := keepLockedChannels(prev, body.Channels)
+	channels, err := normalizeAndValidateChannels(assignChannelIDs(in), prev)
+	var limitErr *limitError
+	if errors.As(err, &limitErr) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "limit": true})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
+	origin := auditOriginOf(c)
+	beforeCfg, beforeChans := GetConfigSnapshot(), GetState()
+	action := "save state"
+	if body.CurrentShow != nil && *body.CurrentShow != "" {
+		action = "load show " + *body.CurrentShow
+	}
 	var oldSQIP, oldDataDir string
 	var haveOldConfig bool
 	if body.SqIP != "" {
@@ -93,135 +185,51 @@ func handlePostState(c *gin.Context) {
 			haveOldConfig = true
 		}
 		if err := SaveConfig(strings.TrimSpace(body.SqIP), ""); err != nil {
+			auditConfigChange("save state", beforeCfg, GetConfigSnapshot(), origin, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 	}
-	if err := SetStateAndCurrentShow(channels, body.CurrentShow); err != nil {
+	if err := SetStateAndCurrentShow(channels, body.CurrentShow, ifRev); err != nil {
 		if body.SqIP != "" && haveOldConfig {
 			_ = SaveConfig(oldSQIP, oldDataDir)
 		}
+		if errors.Is(err, errRevisionConflict) {
+			respondStateConflict(c)
+			return
+		}
+		auditChannels(action, beforeChans, channels, origin, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"channels": GetState(), "current_show": GetCurrentShow(), "line_preamp_ids": localLinePreampIDs})
+	auditConfigChange(action, beforeCfg, GetConfigSnapshot(), origin, nil)
+	auditChannels(action, beforeChans, GetState(), origin, nil)
+	if body.CurrentShow != nil && *body.CurrentShow != "" {
+		audit(auditEntry{Kind: "show", Action: "load", New: *body.CurrentShow}, origin, nil)
+	}
+	if body.SqIP != "" {
+		mixer.SetAddr(sqAddr(strings.TrimSpace(body.SqIP)))
+	}
+	newChans, newShow, rev := GetStateSnapshot()
+	setStateETag(c, rev)
+	out := gin.H{"channels": newChans, "current_show": newShow, "line_preamp_ids": localLinePreampIDs, "revision": rev}
+	if len(kept) > 0 {
+		out["locked_kept"] = kept
+	}
+	c.JSON(http.StatusOK, out)
 }
 
 func handleResetState(c *gin.Context) {
-	if err := ResetState(); err != nil {
+	before := GetState()
+	err := ResetState()
+	auditChannels("reset state", before, GetState(), auditOriginOf(c), err)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"channels": []ChannelState{}, "current_show": ""})
 }
 
-// handlePostSync starts syncing the full backend state to the mixer in the background; returns 202 immediately.
-func handlePostSync(getAddr func(*gin.Context) (string, bool)) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		addr, ok := getAddr(c)
-		if !ok {
-			return
-		}
-		channels := GetState()
-		syncMu.Lock()
-		if syncStatus == "running" {
-			syncMu.Unlock()
-			c.JSON(http.StatusConflict, gin.H{"error": "sync already in progress"})
-			return
-		}
-		syncTotal = 0
-		for _, ch := range channels {
-			if ch.PreampBus == "local" && isLocalLinePreamp(ch.PreampId) {
-				// left is line; only count right if stereo and not line
-				if ch.PreampIdR != 0 && !isLocalLinePreamp(ch.PreampIdR) {
-					syncTotal++
-				}
-				continue
-			}
-			syncTotal++
-			if ch.PreampIdR != 0 {
-				if ch.PreampBus != "local" || !isLocalLinePreamp(ch.PreampIdR) {
-					syncTotal++
-				}
-			}
-		}
-		syncStatus = "running"
-		syncCurrent = 0
-		syncLastResult = nil
-		syncMu.Unlock()
-
-		go runSyncInBackground(addr, channels)
-		c.JSON(http.StatusAccepted, gin.H{"started": true})
-	}
-}
-
-func runSyncInBackground(addr string, channels []ChannelState) {
-	defer func() {
-		syncMu.Lock()
-		syncStatus = "idle"
-		syncMu.Unlock()
-	}()
-
-	sent := 0
-	for _, ch := range channels {
-		bus := ch.PreampBus
-		if bus != "local" && bus != "slink" {
-			bus = "local"
-		}
-		// Collect preamp IDs to send (1 or 2 for stereo); skip local line
-		ids := []int{ch.PreampId}
-		if ch.PreampIdR != 0 && ch.PreampIdR != ch.PreampId {
-			ids = append(ids, ch.PreampIdR)
-		}
-		for _, id := range ids {
-			if bus == "local" && isLocalLinePreamp(id) {
-				continue
-			}
-			syncMu.Lock()
-			syncCurrent = sent
-			syncMu.Unlock()
-
-			var phantomPkt, padPkt, gainPkt []byte
-			if bus == "slink" {
-				phantomPkt = buildPhantomSLink(id, ch.Phantom)
-				padPkt = buildPadSLink(id, ch.Pad)
-				gainPkt = buildGainSLink(id, ch.Gain)
-			} else {
-				phantomPkt = buildPhantom(id, ch.Phantom)
-				padPkt = buildPad(id, ch.Pad)
-				gainPkt = buildGain(id, ch.Gain)
-			}
-			if err := sendToSQ(addr, phantomPkt); err != nil {
-				setSyncResultError(err.Error())
-				return
-			}
-			LogTXPreamp(bus, id, "phantom", boolToOnOff(ch.Phantom))
-			if err := sendToSQ(addr, padPkt); err != nil {
-				setSyncResultError(err.Error())
-				return
-			}
-			LogTXPreamp(bus, id, "pad", boolToOnOff(ch.Pad))
-			if err := sendToSQ(addr, gainPkt); err != nil {
-				setSyncResultError(err.Error())
-				return
-			}
-			LogTXPreamp(bus, id, "gain", fmt.Sprintf("%.0f dB", ch.Gain))
-			time.Sleep(40 * time.Millisecond)
-			sent++
-		}
-	}
-
-	syncMu.Lock()
-	syncLastResult = &syncResult{Synced: sent}
-	syncMu.Unlock()
-}
-
-func setSyncResultError(msg string) {
-	syncMu.Lock()
-	syncLastResult = &syncResult{Error: msg}
-	syncMu.Unlock()
-}
-
 func boolToOnOff(on bool) string {
 	if on {
 		return "on"
@@ -229,14 +237,20 @@ func boolToOnOff(on bool) string {
 	return "off"
 }
 
-func handleGetSyncStatus(c *gin.Context) {
-	syncMu.Lock()
-	defer syncMu.Unlock()
-	out := gin.H{"status": syncStatus, "current": syncCurrent, "total": syncTotal}
-	if syncLastResult != nil {
-		out["last_result"] = syncLastResult
-	}
-	c.JSON(http.StatusOK, out)
+// handleGetStorage reports files that were recovered from their .bak copy since startup and the last failed
+// state write.
+func handleGetStorage(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"recoveries": GetStorageRecoveries(), "persist_error": GetPersistError()})
+}
+
+// handleGetMixerStatus reports whether the shared mixer connection is up right now.
+func handleGetMixerStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, mixer.Status())
+}
+
+// handleGetMixerPreamps lists the last values the mixer reported per preamp.
+func handleGetMixerPreamps(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"preamps": GetMixerPreamps()})
 }
 
 func handleGetShows(c *gin.Context) {
@@ -279,7 +293,9 @@ func handlePostShow(c *gin.Context) {
 	// Persist under sanitized name so client-supplied name cannot affect stored filename.
 	body.Name = name
 	b, _ := json.MarshalIndent(body, "", "  ")
-	if err := SaveShow(name, b); err != nil {
+	err := SaveShow(name, b)
+	audit(auditEntry{Kind: "show", Action: "save", New: name}, auditOriginOf(c), err)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -291,7 +307,9 @@ func handlePostShow(c *gin.Context) {
 
 func handleDeleteShow(c *gin.Context) {
 	name := c.Param("name")
-	if err := DeleteShow(name); err != nil {
+	err := DeleteShow(name)
+	audit(auditEntry{Kind: "show", Action: "delete", Old: name}, auditOriginOf(c), err)
+	if err != nil {
 		if os.IsNotExist(err) {
 			c.JSON(http.StatusNotFound, gin.H{"error": "show not found"})
 			return
@@ -333,7 +351,9 @@ func makeGetAddr(sqPort string) func(*gin.Context) (string, bool) {
 	}
 }
 
-// runPreampBool sends a single phantom or pad command to the mixer (one packet), then updates backend state only.
+// runPreampBool sends a single phantom or pad command to the mixer (one packet via the scheduler), then updates backend state only.
+// Phantom follows the phantom safety policy (phantom.go) unless ?bypass_phantom_safety=1; channel safety limits
+// (limits.go) answer 409 unless ?override_limits=1.
 func runPreampBool(c *gin.Context, getAddr func(*gin.Context) (string, bool), bus string, parseID func(*gin.Context, string) (int, bool), buildFn func(int, bool) []byte, key string) {
 	preamp, ok := parseID(c, c.Param("id"))
 	if !ok {
@@ -344,29 +364,45 @@ func runPreampBool(c *gin.Context, getAddr func(*gin.Context) (string, bool), bu
 		c.JSON(http.StatusOK, gin.H{"preamp": preamp, key: on})
 		return
 	}
-	addr, ok := getAddr(c)
-	if !ok {
+	on := c.Query("on") == "true" || c.Query("on") == "1"
+	if !requireArmed(c) || !requireUnlocked(c, bus, preamp) || !enforceLimits(c, bus, preamp, key, on, 0) {
 		return
 	}
-	on := c.Query("on") == "true" || c.Query("on") == "1"
-	if err := sendToSQ(addr, buildFn(preamp, on)); err != nil {
-		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+	addr, ok := getAddr(c)
+	if !ok {
 		return
 	}
-	val := "off"
-	if on {
-		val = "on"
+	cmd := mixerCmd{
+		Addr: addr, Bus: bus, Preamp: preamp, Param: key, Packet: buildFn(preamp, on), Prio: prioInteractive, Origin: auditOriginOf(c),
+		OnSent: func() {
+			LogTXPreamp(bus, preamp, key, boolToOnOff(on))
+			if key == "phantom" {
+				UpdatePhantom(bus, preamp, on)
+			} else {
+				UpdatePad(bus, preamp, on)
+			}
+		},
 	}
-	LogTXPreamp(bus, preamp, key, val)
+	var err error
 	if key == "phantom" {
-		UpdatePhantom(bus, preamp, on)
+		err = switchPhantomSafely(cmd, on, currentGain(bus, preamp, stateGain(bus, preamp, 0)), phantomPolicy(c))
 	} else {
-		UpdatePad(bus, preamp, on)
+		err = scheduler.Submit(cmd)
 	}
-	c.JSON(http.StatusOK, gin.H{"preamp": preamp, key: on})
+	if errors.Is(err, errDisarmed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "armed": false})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"preamp": preamp, key: on, "revision": GetStateRevision()})
 }
 
-// runPreampGain sends a single gain command to the mixer (one packet), then updates backend state only.
+// runPreampGain sends a single gain command to the mixer (one packet via the scheduler), then updates backend state only.
+// While a slider is dragged, queued gains for the same preamp collapse to the newest value.
+// With ramp_ms the preamp is stepped 1 dB at a time from its current gain; the response comes when it arrives.
 func runPreampGain(c *gin.Context, getAddr func(*gin.Context) (string, bool), bus string, parseID func(*gin.Context, string) (int, bool), buildFn func(int, float64) []byte) {
 	preamp, ok := parseID(c, c.Param("id"))
 	if !ok {
@@ -376,21 +412,37 @@ func runPreampGain(c *gin.Context, getAddr func(*gin.Context) (string, bool), bu
 		c.JSON(http.StatusOK, gin.H{"preamp": preamp, "gain_db": 0})
 		return
 	}
-	addr, ok := getAddr(c)
+	db, ramp, ok := parseGainDB(c)
 	if !ok {
 		return
 	}
-	db, ok := parseGainDB(c)
+	if !requireArmed(c) || !requireUnlocked(c, bus, preamp) || !enforceLimits(c, bus, preamp, "gain", false, db) {
+		return
+	}
+	addr, ok := getAddr(c)
 	if !ok {
 		return
 	}
-	if err := sendToSQ(addr, buildFn(preamp, db)); err != nil {
+	onSent := func() {
+		LogTXPreamp(bus, preamp, "gain", fmt.Sprintf("%.0f dB", db))
+		UpdateGain(bus, preamp, db)
+	}
+	cmd := mixerCmd{Addr: addr, Bus: bus, Preamp: preamp, Param: "gain", Packet: buildFn(preamp, db), Prio: prioInteractive, OnSent: onSent, Origin: auditOriginOf(c)}
+	var err error
+	if ramp > 0 {
+		err = rampGain(cmd, currentGain(bus, preamp, stateGain(bus, preamp, db)), db, ramp)
+	} else {
+		err = scheduler.Submit(cmd)
+	}
+	if errors.Is(err, errRampCancelled) || errors.Is(err, errDisarmed) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
 		return
 	}
-	LogTXPreamp(bus, preamp, "gain", fmt.Sprintf("%.0f dB", db))
-	UpdateGain(bus, preamp, db)
-	c.JSON(http.StatusOK, gin.H{"preamp": preamp, "gain_db": db})
+	c.JSON(http.StatusOK, gin.H{"preamp": preamp, "gain_db": db, "ramp_ms": ramp.Milliseconds(), "revision": GetStateRevision()})
 }
 
 func parseLocalPreampID(c *gin.Context, id string) (int, bool) {
@@ -411,14 +463,16 @@ func parseSLinkPreampID(c *gin.Context, id string) (int, bool) {
 	return n, true
 }
 
-func parseGainDB(c *gin.Context) (float64, bool) {
+// parseGainDB reads the target gain and optional ramp duration: JSON {"db": 12, "ramp_ms": 2000}, or form/query db and ramp_ms.
+func parseGainDB(c *gin.Context) (float64, time.Duration, bool) {
 	var body struct {
-		DB float64 `json:"db"`
+		DB     float64 `json:"db"`
+		RampMS int     `json:"ramp_ms"`
 	}
 	if c.ContentType() == "application/json" {
 		if err := c.ShouldBindJSON(&body); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid json, need {\"db\": 0..60}"})
-			return 0, false
+			return 0, 0, false
 		}
 	} else {
 		dbStr := c.PostForm("db")
@@ -427,23 +481,36 @@ func parseGainDB(c *gin.Context) (float64, bool) {
 		}
 		if dbStr == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "missing db (0..60), query ?db=12 or JSON {\"db\": 12}"})
-			return 0, false
+			return 0, 0, false
 		}
 		var err error
 		body.DB, err = strconv.ParseFloat(dbStr, 64)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "db must be number 0..60"})
-			return 0, false
+			return 0, 0, false
 		}
 	}
 	if body.DB < 0 || body.DB > 60 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "db must be 0..60"})
-		return 0, false
+		return 0, 0, false
+	}
+	if v := c.Query("ramp_ms"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ramp_ms must be a number"})
+			return 0, 0, false
+		}
+		body.RampMS = n
 	}
-	return body.DB, true
+	ramp := time.Duration(body.RampMS) * time.Millisecond
+	if ramp < 0 || ramp > maxRampDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ramp_ms must be 0..%d", maxRampDuration.Milliseconds())})
+		return 0, 0, false
+	}
+	return body.DB, ramp, true
 }
 
-func normalizeAndValidateChannels(in []ChannelState) ([]ChannelState, error) {
+func normalizeAndValidateChannels(in, prev []ChannelState) ([]ChannelState, error) {
 	if len(in) == 0 {
 		return in, nil
 	}
@@ -476,6 +543,19 @@ func normalizeAndValidateChannels(in []ChannelState) ([]ChannelState, error) {
 		default:
 			return nil, fmt.Errorf("channel %d: invalid preampBus %q (expected local or slink)", c.ID, c.PreampBus)
 		}
+		var tags []string
+		for _, t := range c.Tags {
+			if t = strings.TrimSpace(t); t != "" {
+				tags = append(tags, t)
+			}
+		}
+		c.Tags = tags
+		if c.MaxGain != nil && (*c.MaxGain < gainDBMin || *c.MaxGain > gainDBMax) {
+			return nil, fmt.Errorf("channel %d: maxGain must be %d..%d", c.ID, gainDBMin, gainDBMax)
+		}
+	}
+	if err := validateChannelLimits(out, prev); err != nil {
+		return nil, err
 	}
 	return out, nil
 }
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Undo/redo: every change to the channel list (preamp values, state saves, show loads, reset) is recorded as
+// a before/after snapshot. The history is bounded, kept in memory and in history.json next to state.json
+// (written together with it, persist.go).
+// Repeated changes to the same preamp parameter within historyCoalesce (slider drags) form one entry.
+// Undo and redo never change locked channels.
+
+const (
+	historyMax      = 50
+	historyCoalesce = 2 * time.Second
+)
+
+type historyEntry struct {
+	Time   time.Time      `json:"time"`
+	Action string         `json:"action"`
+	key    string         // coalescing key; empty = never coalesce
+	Before []ChannelState `json:"before"`
+	After  []ChannelState `json:"after"`
+}
+
+type historyFile struct {
+	Undo []historyEntry `json:"undo"`
+	Redo []historyEntry `json:"redo"`
+}
+
+// Guarded by stateMu.
+var (
+	histUndo []historyEntry
+	histRedo []historyEntry
+)
+
+func historyPath() string { return filepath.Join(GetDataDir(), "history.json") }
+
+func cloneChannels(in []ChannelState) []ChannelState {
+	return append([]ChannelState{}, in...)
+}
+
+// recordHistoryLocked records the change from before to the current stateChans, if there was one.
+// Caller holds stateMu.
+func recordHistoryLocked(action, key string, before []ChannelState) {
+	after := cloneChannels(stateChans)
+	if reflect.DeepEqual(before, after) {
+		return
+	}
+	now := time.Now()
+	if n := len(histUndo); n > 0 && key != "" && histUndo[n-1].key == key && now.Sub(histUndo[n-1].Time) < historyCoalesce {
+		histUndo[n-1].Action, histUndo[n-1].After, histUndo[n-1].Time = action, after, now
+	} else {
+		histUndo = append(histUndo, historyEntry{Time: now, Action: action, key: key, Before: before, After: after})
+		if len(histUndo) > historyMax {
+			histUndo = histUndo[len(histUndo)-historyMax:]
+		}
+	}
+	histRedo = nil
+}
+
+// loadHistoryLocked reads history.json; a missing or unreadable file means an empty history.
+func loadHistoryLocked() {
+	histUndo, histRedo = nil, nil
+	b, err := os.ReadFile(historyPath())
+	if err != nil {
+		return
+	}
+	var file historyFile
+	if err := json.Unmarshal(b, &file); err != nil {
+		log.Printf("sqapi: history.json unreadable, starting empty: %v", err)
+		return
+	}
+	histUndo, histRedo = file.Undo, file.Redo
+}
+
+// stepHistory undoes (undo=true) or redoes the latest entry. Returns the channels before and after the step
+// and the entry's action; ok is false if there is nothing to undo/redo.
+func stepHistory(undo bool) (from, to []ChannelState, action string, ok bool, err error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	src, dst := &histUndo, &histRedo
+	if !undo {
+		src, dst = &histRedo, &histUndo
+	}
+	if len(*src) == 0 {
+		return nil, nil, "", false, nil
+	}
+	e := (*src)[len(*src)-1]
+	*src = (*src)[:len(*src)-1]
+	*dst = append(*dst, e)
+	target := e.Before
+	if !undo {
+		target = e.After
+	}
+	from = cloneChannels(stateChans)
+	// Lock flags are only changed by the lock endpoints: take them from the current state.
+	locked := map[int]bool{}
+	for _, ch := range from {
+		locked[ch.ID] = ch.Locked
+	}
+	target = cloneChannels(target)
+	for i := range target {
+		target[i].Locked = locked[target[i].ID]
+	}
+	target, _ = keepLockedChannels(from, target)
+	stateChans = target
+	return from, cloneChannels(stateChans), e.Action, true, saveStateLocked()
+}
+
+// preampChange is one preamp whose values differ between two channel lists: the target step and the ops for
+// only the parameters that changed.
+type preampChange struct {
+	step syncStep
+	ops  []syncOp
+}
+
+// changedPreamps compares from and to per preamp parameter.
+func changedPreamps(from, to []ChannelState) []preampChange {
+	old := map[preampKey]syncStep{}
+	for _, s := range buildSyncPlan(from) {
+		old[preampKey{s.Bus, s.Preamp}] = s
+	}
+	var out []preampChange
+	for _, s := range buildSyncPlan(to) {
+		o, known := old[preampKey{s.Bus, s.Preamp}]
+		ch := preampChange{step: s}
+		for _, op := range s.ops(0) {
+			if !known || (op.Param == "phantom" && o.Phantom != s.Phantom) || (op.Param == "pad" && o.Pad != s.Pad) ||
+				(op.Param == "gain" && o.Gain != s.Gain) {
+				ch.ops = append(ch.ops, op)
+			}
+		}
+		if len(ch.ops) > 0 {
+			out = append(out, ch)
+		}
+	}
+	return out
+}
+
+// handleStateHistory serves POST /api/state/undo and /redo. With ?send=1 the preamp parameters whose values
+// changed are re-sent so the desk follows: phantom through the safety policy, and each checked against the
+// safety limits (refused ones are listed, unless ?override_limits=1).
+func handleStateHistory(getAddr func(*gin.Context) (string, bool), undo bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		send := c.Query("send") == "1" || c.Query("send") == "true"
+		override := c.Query("override_limits") == "1" || c.Query("override_limits") == "true"
+		var addr string
+		if send {
+			var ok bool
+			if !requireArmed(c) {
+				return
+			}
+			if addr, ok = getAddr(c); !ok {
+				return
+			}
+		}
+		what := "redo"
+		if undo {
+			what = "undo"
+		}
+		from, to, action, ok, err := stepHistory(undo)
+		if !ok {
+			c.JSON(http.StatusConflict, gin.H{"error": "nothing to " + what})
+			return
+		}
+		origin := auditOriginOf(c)
+		auditChannels(what+": "+action, from, to, origin, err)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		out := gin.H{"action": action, "channels": to}
+		if send {
+			sent := 0
+			var refused []string
+			for _, ch := range changedPreamps(from, to) {
+				s := ch.step
+				for _, op := range ch.ops {
+					if err := s.checkLimits(op.Param); err != nil {
+						if !override {
+							refused = append(refused, err.Error())
+							continue
+						}
+						overrideLimit(err)
+					}
+					cmd := op.cmd(addr, prioInteractive)
+					cmd.Origin = origin
+					var err error
+					if op.Param == "phantom" {
+						err = switchPhantomSafely(cmd, s.Phantom, s.Gain, phantomPolicy(c))
+					} else {
+						err = scheduler.Submit(cmd)
+					}
+					if err != nil {
+						out["sent"] = sent
+						out["send_error"] = fmt.Sprintf("%s preamp %d %s: %v", op.Bus, op.Preamp, op.Param, err)
+						c.JSON(http.StatusBadGateway, out)
+						return
+					}
+					sent++
+				}
+			}
+			out["sent"] = sent // parameters
+			if len(refused) > 0 {
+				out["limit_errors"] = refused
+				c.JSON(http.StatusConflict, out)
+				return
+			}
+		}
+		c.JSON(http.StatusOK, out)
+	}
+}
+
+// handleGetStateHistory lists the undo and redo entries (newest last) without their snapshots.
+func handleGetStateHistory(c *gin.Context) {
+	type item struct {
+		Time   time.Time `json:"time"`
+		Action string    `json:"action"`
+	}
+	list := func(entries []historyEntry) []item {
+		out := []item{}
+		for _, e := range entries {
+			out = append(out, item{e.Time, e.Action})
+		}
+		return out
+	}
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	c.JSON(http.StatusOK, gin.H{"undo": list(histUndo), "redo": list(histRedo)})
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestChangedPreampsPerParameter(t *testing.T) {
+	from := []ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 1, Gain: 20, Phantom: true},
+		{ID: 2, PreampBus: "local", PreampId: 2, Gain: 30},
+	}
+	to := []ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 1, Gain: 25, Phantom: true},
+		{ID: 2, PreampBus: "local", PreampId: 2, Gain: 30},
+		{ID: 3, PreampBus: "slink", PreampId: 7},
+	}
+	changes := changedPreamps(from, to)
+	if len(changes) != 2 {
+		t.Fatalf("%d changed preamps, want 2: %+v", len(changes), changes)
+	}
+	if ops := changes[0].ops; len(ops) != 1 || ops[0].Param != "gain" || ops[0].Preamp != 1 {
+		t.Errorf("local 1: ops %+v, want only gain", ops)
+	}
+	if ops := changes[1].ops; len(ops) != 3 || ops[0].Bus != "slink" {
+		t.Errorf("new preamp slink 7: ops %+v, want all three", ops)
+	}
+}
+
+func TestUndoRedo(t *testing.T) {
+	useTempDataDir(t)
+	if err := SetStateAndCurrentShow([]ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 1, Gain: 10},
+		{ID: 2, PreampBus: "local", PreampId: 2, Gain: 10},
+	}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	stateMu.Lock()
+	histUndo, histRedo = nil, nil
+	stateMu.Unlock()
+	gain := func(id int) float64 {
+		for _, ch := range GetState() {
+			if ch.ID == id {
+				return ch.Gain
+			}
+		}
+		return -1
+	}
+
+	// A slider drag is one entry.
+	UpdateGain("local", 1, 20)
+	UpdateGain("local", 1, 25)
+	if _, _, _, ok, err := stepHistory(true); !ok || err != nil || gain(1) != 10 {
+		t.Fatalf("undo drag: ok %v, err %v, gain %v, want 10", ok, err, gain(1))
+	}
+	if _, _, _, ok, _ := stepHistory(true); ok {
+		t.Fatal("second undo: want nothing left")
+	}
+
+	// A new change clears the redo list.
+	UpdateGain("local", 2, 30)
+	if _, _, _, ok, _ := stepHistory(false); ok {
+		t.Fatal("redo after a new change: want nothing to redo")
+	}
+
+	// Undo leaves locked channels alone.
+	UpdateGain("local", 1, 40)
+	if _, err := SetChannelLocked(1, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, ok, _ := stepHistory(true); !ok || gain(1) != 40 {
+		t.Errorf("undo over a locked channel: gain %v, want 40", gain(1))
+	}
+	if _, _, _, ok, _ := stepHistory(true); !ok || gain(2) != 10 {
+		t.Errorf("undo unlocked channel: gain %v, want 10", gain(2))
+	}
+}
+
+func TestLoadStateReplacesHistory(t *testing.T) {
+	useTempDataDir(t)
+	for name, content := range map[string]string{
+		"missing": "",
+		"legacy":  `[{"id": 2, "preampBus": "local", "preampId": 2}]`,
+	} {
+		// history in the old dir
+		if err := SetStateAndCurrentShow([]ChannelState{{ID: 1, PreampBus: "local", PreampId: 1}}, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		UpdateGain("local", 1, 30)
+		dir := useTempDataDir(t)
+		if content != "" {
+			if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := LoadState(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, _, _, ok, _ := stepHistory(true); ok {
+			t.Errorf("%s: undo after switching dirs steps back into the old dir's history", name)
+		}
+	}
+}
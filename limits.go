@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Per-channel safety limits (maxGain, phantomForbidden, padRequired on ChannelState) are enforced on every
+// path that sends to a preamp, not only in the UI. A preamp used by several channels gets the strictest of
+// their limits. Violations are refused with 409 unless the request overrides them, which is logged.
+
+// limitError is a safety limit violation; handlers answer it with 409.
+type limitError struct{ msg string }
+
+func (e *limitError) Error() string { return e.msg }
+
+// preampLimits are the combined limits of every channel using one preamp.
+type preampLimits struct {
+	MaxGain          *float64
+	PhantomForbidden bool
+	PadRequired      bool
+	channel          int // a channel that set the limit, for error messages
+}
+
+func (ch ChannelState) usesPreamp(bus string, preamp int) bool {
+	b := ch.PreampBus
+	if b == "" {
+		b = "local"
+	}
+	return b == bus && (ch.PreampId == preamp || ch.PreampIdR == preamp)
+}
+
+// limitsFor combines the limits of the channels in channels that use bus/preamp.
+func limitsFor(channels []ChannelState, bus string, preamp int) preampLimits {
+	var l preampLimits
+	for _, ch := range channels {
+		if !ch.usesPreamp(bus, preamp) {
+			continue
+		}
+		if ch.MaxGain != nil && (l.MaxGain == nil || *ch.MaxGain < *l.MaxGain) {
+			g := *ch.MaxGain
+			l.MaxGain, l.channel = &g, ch.ID
+		}
+		if ch.PhantomForbidden {
+			l.PhantomForbidden, l.channel = true, ch.ID
+		}
+		if ch.PadRequired {
+			l.PadRequired, l.channel = true, ch.ID
+		}
+	}
+	return l
+}
+
+// check returns a *limitError if setting param ("phantom" | "pad" | "gain") to on/db breaks the limits.
+func (l preampLimits) check(bus string, preamp int, param string, on bool, db float64) error {
+	switch {
+	case param == "phantom" && on && l.PhantomForbidden:
+		return &limitError{fmt.Sprintf("%s preamp %d: phantom is forbidden (channel %d)", bus, preamp, l.channel)}
+	case param == "pad" && !on && l.PadRequired:
+		return &limitError{fmt.Sprintf("%s preamp %d: pad is required (channel %d)", bus, preamp, l.channel)}
+	case param == "gain" && l.MaxGain != nil && db > *l.MaxGain:
+		return &limitError{fmt.Sprintf("%s preamp %d: gain %.0f dB exceeds max %.0f dB (channel %d)", bus, preamp, db, *l.MaxGain, l.channel)}
+	}
+	return nil
+}
+
+// checkPreampLimits checks one parameter change against the limits in the current state.
+func checkPreampLimits(bus string, preamp int, param string, on bool, db float64) error {
+	return limitsFor(GetState(), bus, preamp).check(bus, preamp, param, on, db)
+}
+
+// overrideLimit logs a limit violation that is sent anyway.
+func overrideLimit(err error) {
+	log.Printf("sqapi: safety limit OVERRIDE: %v", err)
+}
+
+// enforceLimits checks a preamp endpoint request; on a violation it answers 409 and returns false, unless
+// ?override_limits=1 is set.
+func enforceLimits(c *gin.Context, bus string, preamp int, param string, on bool, db float64) bool {
+	err := checkPreampLimits(bus, preamp, param, on, db)
+	if err == nil {
+		return true
+	}
+	if c.Query("override_limits") == "1" || c.Query("override_limits") == "true" {
+		overrideLimit(err)
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "limit": true})
+	return false
+}
+
+// validateChannelLimits checks every channel's own values against the limits of the preamps it uses. Values
+// prev already holds for the preamp are not checked: an override or a pull may have stored them, and saving
+// an unrelated edit must not be refused for it.
+func validateChannelLimits(channels, prev []ChannelState) error {
+	for _, ch := range channels {
+		ids := []int{ch.PreampId}
+		if ch.PreampIdR != 0 && ch.PreampIdR != ch.PreampId {
+			ids = append(ids, ch.PreampIdR)
+		}
+		for _, id := range ids {
+			if ch.PreampBus == "local" && isLocalLinePreamp(id) {
+				continue
+			}
+			l := limitsFor(channels, ch.PreampBus, id)
+			old, stored := storedPreamp(prev, ch.PreampBus, id)
+			for _, c := range []struct {
+				param   string
+				on      bool
+				db      float64
+				changed bool
+			}{
+				{"phantom", ch.Phantom, 0, !stored || old.Phantom != ch.Phantom},
+				{"pad", ch.Pad, 0, !stored || old.Pad != ch.Pad},
+				{"gain", false, ch.Gain, !stored || old.Gain != ch.Gain},
+			} {
+				if !c.changed {
+					continue
+				}
+				if err := l.check(ch.PreampBus, id, c.param, c.on, c.db); err != nil {
+					return &limitError{fmt.Sprintf("channel %d: %v", ch.ID, err)}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// storedPreamp returns a channel in channels that uses bus/preamp, if any.
+func storedPreamp(channels []ChannelState, bus string, preamp int) (ChannelState, bool) {
+	for _, ch := range channels {
+		if ch.usesPreamp(bus, preamp) {
+			return ch, true
+		}
+	}
+	return ChannelState{}, false
+}
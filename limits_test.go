@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestValidateChannelLimits(t *testing.T) {
+	max := 30.0
+	ok := []ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 3, Gain: 30, MaxGain: &max, PhantomForbidden: true},
+		{ID: 2, PreampBus: "slink", PreampId: 3, Phantom: true, Gain: 50}, // same number, other bus
+	}
+	if err := validateChannelLimits(ok, nil); err != nil {
+		t.Fatalf("valid channels: %v", err)
+	}
+	for name, channels := range map[string][]ChannelState{
+		"gain":    {{ID: 1, PreampBus: "local", PreampId: 3, Gain: 31, MaxGain: &max}},
+		"phantom": {{ID: 1, PreampBus: "local", PreampId: 3, Phantom: true, PhantomForbidden: true}},
+		"pad":     {{ID: 1, PreampBus: "slink", PreampId: 9, PadRequired: true}},
+		// another channel on the same preamp imposes its limit
+		"shared": {
+			{ID: 1, PreampBus: "slink", PreampId: 5, PreampIdR: 6, Phantom: true},
+			{ID: 2, PreampBus: "slink", PreampId: 6, PhantomForbidden: true},
+		},
+	} {
+		var le *limitError
+		if err := validateChannelLimits(channels, nil); !errors.As(err, &le) {
+			t.Errorf("%s: got %v, want a limit error", name, err)
+		}
+	}
+}
+
+func TestSaveAfterOverride(t *testing.T) {
+	useTempDataDir(t)
+	max := 30.0
+	if err := SetStateAndCurrentShow([]ChannelState{{ID: 1, PreampBus: "local", PreampId: 3, Gain: 20, MaxGain: &max}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	UpdateGain("local", 3, 40) // what an override_limits=1 send (or a pull) stores
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/state", handlePostState)
+	r.PATCH("/api/channels/:id", handlePatchChannel)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do("PATCH", "/api/channels/1", `{"name": "Vox"}`); w.Code != http.StatusOK {
+		t.Errorf("rename after override: %d %s", w.Code, w.Body)
+	}
+	state := `{"channels": [{"id": 1, "name": "Lead", "preampBus": "local", "preampId": 3, "gain": 40, "maxGain": 30}]}`
+	if w := do("POST", "/api/state", state); w.Code != http.StatusOK {
+		t.Errorf("save after override: %d %s", w.Code, w.Body)
+	}
+	if w := do("PATCH", "/api/channels/1", `{"gain": 45}`); w.Code != http.StatusConflict {
+		t.Errorf("new gain over the limit: %d %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Channel locks: a locked channel's preamps cannot be changed by the preamp endpoints, overwritten by
+// POST /api/state (and so show loads) or sent by sync. Only the explicit lock/unlock endpoints change the flag.
+
+// lockedChannelFor returns the ID of a locked channel using bus/preamp.
+func lockedChannelFor(channels []ChannelState, bus string, preamp int) (int, bool) {
+	for _, ch := range channels {
+		if ch.Locked && ch.usesPreamp(bus, preamp) {
+			return ch.ID, true
+		}
+	}
+	return 0, false
+}
+
+// requireUnlocked answers 409 and returns false if a locked channel uses bus/preamp.
+func requireUnlocked(c *gin.Context, bus string, preamp int) bool {
+	id, locked := lockedChannelFor(GetState(), bus, preamp)
+	if !locked {
+		return true
+	}
+	c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("%s preamp %d belongs to locked channel %d", bus, preamp, id), "locked_channel": id})
+	return false
+}
+
+// keepLockedChannels returns in with every locked channel of old restored: a channel with the same ID gets
+// the old preamp assignment and values back, a missing one is appended. Also returns the IDs kept.
+func keepLockedChannels(old, in []ChannelState) ([]ChannelState, []int) {
+	var kept []int
+	for _, o := range old {
+		if !o.Locked {
+			continue
+		}
+		kept = append(kept, o.ID)
+		found := false
+		for i := range in {
+			if in[i].ID != o.ID {
+				continue
+			}
+			found = true
+			n := &in[i]
+			n.PreampBus, n.PreampId, n.PreampIdR = o.PreampBus, o.PreampId, o.PreampIdR
+			n.Phantom, n.Pad, n.Gain = o.Phantom, o.Pad, o.Gain
+			n.MaxGain, n.PhantomForbidden, n.PadRequired = o.MaxGain, o.PhantomForbidden, o.PadRequired
+			n.Locked = true
+		}
+		if !found {
+			in = append(in, o)
+		}
+	}
+	return in, kept
+}
+
+// handleLockChannel locks (locked=true) or unlocks a channel by ID.
+func handleLockChannel(locked bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "channel id must be a number"})
+			return
+		}
+		before := GetState()
+		found, err := SetChannelLocked(id, locked)
+		if found {
+			action := "unlock"
+			if locked {
+				action = "lock"
+			}
+			auditChannels(action, before, GetState(), auditOriginOf(c), err)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if !found {
+			c.JSON(http.StatusNotFound, gin.H{"error": "channel not found"})
+			return
+		}
+		if locked {
+			log.Printf("sqapi: channel %d locked", id)
+		} else {
+			log.Printf("sqapi: channel %d unlocked", id)
+		}
+		c.JSON(http.StatusOK, gin.H{"id": id, "locked": locked})
+	}
+}
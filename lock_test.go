@@ -0,0 +1,53 @@
+package main
+
+import "testing"
+
+func TestKeepLockedChannels(t *testing.T) {
+	old := []ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 17, Gain: 10, Locked: true},
+		{ID: 2, PreampBus: "local", PreampId: 2, Gain: 20, Phantom: true, Locked: true},
+		{ID: 3, PreampBus: "local", PreampId: 3},
+	}
+	in := []ChannelState{
+		{ID: 1, Name: "TB", PreampBus: "slink", PreampId: 5, Gain: 50, Phantom: true}, // show load over a locked channel
+		{ID: 3, PreampBus: "local", PreampId: 3, Gain: 30},
+	}
+	out, kept := keepLockedChannels(old, in)
+	if len(kept) != 2 || len(out) != 3 {
+		t.Fatalf("kept %v, out %+v", kept, out)
+	}
+	if c := out[0]; c.Name != "TB" || c.PreampBus != "local" || c.PreampId != 17 || c.Gain != 10 || c.Phantom || !c.Locked {
+		t.Errorf("locked channel 1 = %+v", c)
+	}
+	if c := out[2]; c.ID != 2 || c.Gain != 20 || !c.Phantom {
+		t.Errorf("removed locked channel not restored: %+v", c)
+	}
+	if out[1].Gain != 30 {
+		t.Errorf("unlocked channel changed: %+v", out[1])
+	}
+}
+
+func TestDryRunBlocksLockedPreamps(t *testing.T) {
+	channels := []ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 4, Gain: 10, Locked: true},
+		{ID: 2, PreampBus: "local", PreampId: 5, Gain: 20},
+	}
+	stateMu.Lock()
+	saved := stateChans
+	stateChans = channels
+	stateMu.Unlock()
+	t.Cleanup(func() {
+		stateMu.Lock()
+		stateChans = saved
+		stateMu.Unlock()
+	})
+	out := dryRunSync(buildSyncPlan(channels), syncRequest{})
+	for _, op := range out["operations"].([]syncOp) {
+		if blocked := op.Blocked != ""; blocked != (op.Preamp == 4) {
+			t.Errorf("preamp %d %s: blocked %q", op.Preamp, op.Param, op.Blocked)
+		}
+	}
+	if locked, _ := out["locked"].([]preampKey); len(locked) != 1 || locked[0] != (preampKey{"local", 4}) {
+		t.Errorf("locked = %v", out["locked"])
+	}
+}
@@ -43,6 +43,19 @@ func init() {
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "simulate":
+			runSimulate(os.Args[2:])
+			return
+		case "proxy":
+			runProxy(os.Args[2:])
+			return
+		case "replay":
+			runReplay(os.Args[2:])
+			return
+		}
+	}
 	// When run from a macOS .app bundle, CWD is often home; use the folder containing the .app for config/data.
 	if exe, err := os.Executable(); err == nil {
 		if dir := filepath.Dir(exe); strings.Contains(dir, ".app/Contents/MacOS") {
@@ -66,6 +79,11 @@ func main() {
 	if err := LoadState(); err != nil {
 		log.Printf("sqapi: load state: %v", err)
 	}
+	mixer.SetAddr(sqAddr(sqip))
+	mixer.Start()
+	defer mixer.Close()
+	scheduler.Start()
+	startStatePersister()
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
@@ -111,10 +129,38 @@ func main() {
 	r.GET("/api/state", handleGetState)
 	r.POST("/api/state", handlePostState)
 	r.POST("/api/state/reset", handleResetState)
+	r.POST("/api/state/flush", handlePostStateFlush)
 
 	getAddr := makeGetAddr(sqPort)
 	r.POST("/api/sync", handlePostSync(getAddr))
 	r.GET("/api/sync/status", handleGetSyncStatus)
+	r.GET("/api/sync/history", handleGetSyncHistory)
+	r.DELETE("/api/sync", syncJobAction("cancel"))
+	r.POST("/api/sync/cancel", syncJobAction("cancel"))
+	r.POST("/api/sync/pause", syncJobAction("pause"))
+	r.POST("/api/sync/resume", syncJobAction("resume"))
+	r.POST("/api/panic/phantom-off", handlePostPanicPhantomOff(getAddr))
+	r.GET("/api/state/history", handleGetStateHistory)
+	r.GET("/api/storage", handleGetStorage)
+	r.GET("/api/audit", handleGetAudit)
+	r.POST("/api/state/undo", handleStateHistory(getAddr, true))
+	r.POST("/api/state/redo", handleStateHistory(getAddr, false))
+	r.GET("/api/channels", handleGetChannels)
+	r.POST("/api/channels", handlePostChannel)
+	r.GET("/api/channels/:id", handleGetChannel)
+	r.PATCH("/api/channels/:id", handlePatchChannel)
+	r.DELETE("/api/channels/:id", handleDeleteChannel)
+	r.POST("/api/channels/:id/move", handleMoveChannel)
+	r.POST("/api/channels/:id/lock", handleLockChannel(true))
+	r.POST("/api/channels/:id/unlock", handleLockChannel(false))
+	r.GET("/api/armed", handleGetArmed)
+	r.POST("/api/armed", handlePostArmed)
+	r.GET("/api/preamps", handleGetPreamps)
+	r.POST("/api/preamps/reset-unused", handlePostResetUnused(getAddr))
+	r.POST("/api/pull", handlePostPull(getAddr))
+	r.GET("/api/pull/status", handleGetPullStatus)
+	r.GET("/api/mixer/status", handleGetMixerStatus)
+	r.GET("/api/mixer/preamps", handleGetMixerPreamps)
 
 	r.GET("/api/shows", handleGetShows)
 	r.GET("/api/shows/:name", handleGetShow)
@@ -155,4 +201,8 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Printf("sqapi: shutdown: %v", err)
 	}
+	if err := FlushState(); err != nil {
+		log.Printf("sqapi: flush state on exit: %v", err)
+	}
+	flushAudit()
 }
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// Connection states reported by GET /api/mixer/status.
+const (
+	mixerIdle         = "idle" // no SQ IP configured
+	mixerConnecting   = "connecting"
+	mixerConnected    = "connected"
+	mixerDisconnected = "disconnected"
+)
+
+const (
+	mixerBackoffMin = 500 * time.Millisecond
+	mixerBackoffMax = 10 * time.Second
+	mixerKeepAlive  = 15 * time.Second // TCP keepalive; the SQ protocol has no known no-op frame
+)
+
+var errNoMixerAddr = errors.New("SQ IP not set")
+
+// mixerSession owns the single long-lived TCP connection to the SQ (port 51326).
+// Sends reuse the open connection; a background loop reconnects with backoff and reads inbound data.
+type mixerSession struct {
+	dialMu  sync.Mutex // serializes dialing so Send and the run loop never open two connections
+	writeMu sync.Mutex // one packet on the wire at a time
+
+	mu       sync.Mutex
+	addr     string
+	conn     net.Conn
+	state    string
+	since    time.Time
+	lastErr  string
+	connects int
+	closed   bool
+	wake     chan struct{}
+}
+
+type mixerStatus struct {
+	State     string    `json:"state"`
+	Addr      string    `json:"addr,omitempty"`
+	Since     time.Time `json:"since"`
+	LastError string    `json:"last_error,omitempty"`
+	Connects  int       `json:"connects"`
+}
+
+var mixer = newMixerSession()
+
+func newMixerSession() *mixerSession {
+	return &mixerSession{state: mixerIdle, since: time.Now(), wake: make(chan struct{}, 1)}
+}
+
+// sqAddr returns host:port for the configured SQ IP, or "" if not set.
+func sqAddr(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	return net.JoinHostPort(ip, sqPort)
+}
+
+// Start runs the reconnect/read loop until Close.
+func (m *mixerSession) Start() {
+	go m.run()
+}
+
+// Close drops the connection and stops the run loop.
+func (m *mixerSession) Close() {
+	m.mu.Lock()
+	m.closed = true
+	conn := m.conn
+	m.conn = nil
+	m.mu.Unlock()
+	if conn != nil {
+		_ = conn.Close()
+	}
+	m.kick()
+}
+
+// SetAddr points the session at a (possibly new) mixer address; a changed address drops the current connection.
+func (m *mixerSession) SetAddr(addr string) {
+	m.mu.Lock()
+	if m.addr == addr {
+		m.mu.Unlock()
+		return
+	}
+	m.addr = addr
+	conn := m.conn
+	m.conn = nil
+	clearMixerPreamps()
+	if addr == "" {
+		m.setStateLocked(mixerIdle, "")
+	} else {
+		m.setStateLocked(mixerDisconnected, "")
+	}
+	m.mu.Unlock()
+	if conn != nil {
+		_ = conn.Close()
+	}
+	m.kick()
+}
+
+func (m *mixerSession) Status() mixerStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return mixerStatus{State: m.state, Addr: m.addr, Since: m.since, LastError: m.lastErr, Connects: m.connects}
+}
+
+// Connect points the session at addr and makes sure the connection is up, so inbound frames are being read.
+func (m *mixerSession) Connect(addr string) error {
+	m.SetAddr(addr)
+	_, err := m.ensureConn()
+	return err
+}
+
+// Send writes one packet on the shared connection, dialing if needed.
+// A write on a stale connection is retried once on a fresh one.
+func (m *mixerSession) Send(addr string, payload []byte) error {
+	m.SetAddr(addr)
+	var lastErr error
+	for attempt := 0; attempt < 2; attempt++ {
+		conn, err := m.ensureConn()
+		if err != nil {
+			return err
+		}
+		m.writeMu.Lock()
+		_ = conn.SetWriteDeadline(time.Now().Add(sqTimeout))
+		_, err = conn.Write(payload)
+		m.writeMu.Unlock()
+		if err == nil {
+			return nil
+		}
+		m.drop(conn, err)
+		lastErr = err
+	}
+	return fmt.Errorf("write: %w", lastErr)
+}
+
+func (m *mixerSession) kick() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *mixerSession) setStateLocked(state, errMsg string) {
+	if m.state != state {
+		m.since = time.Now()
+	}
+	m.state = state
+	if errMsg != "" || state == mixerConnected {
+		m.lastErr = errMsg
+	}
+}
+
+// ensureConn returns the open connection or dials a new one.
+func (m *mixerSession) ensureConn() (net.Conn, error) {
+	m.dialMu.Lock()
+	defer m.dialMu.Unlock()
+	m.mu.Lock()
+	addr, conn, closed := m.addr, m.conn, m.closed
+	if conn == nil && addr != "" && !closed {
+		m.setStateLocked(mixerConnecting, "")
+	}
+	m.mu.Unlock()
+	if closed {
+		return nil, errors.New("mixer session closed")
+	}
+	if conn != nil {
+		return conn, nil
+	}
+	if addr == "" {
+		return nil, errNoMixerAddr
+	}
+	d := net.Dialer{Timeout: sqTimeout, KeepAlive: mixerKeepAlive}
+	c, err := d.Dial("tcp", addr)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		err = fmt.Errorf("dial %s: %w", addr, err)
+		if m.addr == addr {
+			m.setStateLocked(mixerDisconnected, err.Error())
+		}
+		return nil, err
+	}
+	if m.addr != addr || m.closed {
+		_ = c.Close()
+		return nil, fmt.Errorf("dial %s: address changed", addr)
+	}
+	m.conn = c
+	m.connects++
+	m.setStateLocked(mixerConnected, "")
+	log.Printf("sqapi: mixer connected %s", addr)
+	m.kick()
+	return c, nil
+}
+
+// drop closes conn if it is still the current connection.
+func (m *mixerSession) drop(conn net.Conn, cause error) {
+	m.mu.Lock()
+	if m.conn == conn {
+		m.conn = nil
+		msg := ""
+		if cause != nil {
+			msg = cause.Error()
+		}
+		m.setStateLocked(mixerDisconnected, msg)
+		log.Printf("sqapi: mixer disconnected %s: %v", m.addr, cause)
+		clearMixerPreamps()
+	}
+	m.mu.Unlock()
+	_ = conn.Close()
+}
+
+func (m *mixerSession) run() {
+	backoff := mixerBackoffMin
+	for {
+		m.mu.Lock()
+		closed := m.closed
+		m.mu.Unlock()
+		if closed {
+			return
+		}
+		conn, err := m.ensureConn()
+		if err != nil {
+			wait := backoff
+			if errors.Is(err, errNoMixerAddr) {
+				wait = time.Hour // until SetAddr wakes us
+			} else {
+				backoff *= 2
+				if backoff > mixerBackoffMax {
+					backoff = mixerBackoffMax
+				}
+			}
+			select {
+			case <-m.wake:
+			case <-time.After(wait):
+			}
+			continue
+		}
+		backoff = mixerBackoffMin
+		m.drop(conn, m.readLoop(conn))
+	}
+}
+
+// readLoop decodes inbound frames into the mixer state table; it returns when the connection fails.
+func (m *mixerSession) readLoop(conn net.Conn) error {
+	buf := make([]byte, 1024)
+	var pending []byte
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return err
+		}
+		var chunks [][]byte
+		chunks, pending = splitFrames(append(pending, buf[:n]...))
+		for _, chunk := range chunks {
+			f, err := parseFrame(chunk)
+			if err != nil {
+				continue // not a preamp frame we understand
+			}
+			LogRXPreamp(f)
+			recordMixerFrame(f, "mixer")
+		}
+		pending = append([]byte(nil), pending...)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Last known mixer state per preamp: frames the SQ sends us (console surface, SQ-MixPad, ...) and packets we
+// sent successfully. Separate from stateChans: this is what the desk has, stateChans is what we want.
+// Cleared when the connection drops, since the desk may have changed or rebooted meanwhile.
+
+type preampKey struct {
+	Bus string `json:"bus"`
+	ID  int    `json:"preampId"`
+}
+
+// mixerPreamp holds the last value seen for each parameter; nil = never seen.
+type mixerPreamp struct {
+	Phantom *bool     `json:"phantom,omitempty"`
+	Pad     *bool     `json:"pad,omitempty"`
+	Gain    *float64  `json:"gain,omitempty"`
+	Updated time.Time `json:"updated"`
+	Source  string    `json:"source"` // last update: "mixer" (received) or "sent"
+	Sources struct {
+		Phantom string `json:"phantom,omitempty"`
+		Pad     string `json:"pad,omitempty"`
+		Gain    string `json:"gain,omitempty"`
+	} `json:"sources"` // per parameter: where the value came from
+}
+
+// fromMixer reports whether the value of param was received from the mixer rather than one we sent.
+func (p mixerPreamp) fromMixer(param string) bool {
+	switch param {
+	case "phantom":
+		return p.Phantom != nil && p.Sources.Phantom == "mixer"
+	case "pad":
+		return p.Pad != nil && p.Sources.Pad == "mixer"
+	case "gain":
+		return p.Gain != nil && p.Sources.Gain == "mixer"
+	}
+	return false
+}
+
+// mixerPreampView is one row of GET /api/mixer/preamps.
+type mixerPreampView struct {
+	Bus      string `json:"bus"`
+	PreampId int    `json:"preampId"`
+	mixerPreamp
+	Differs []string `json:"differs,omitempty"` // parameters where state.json disagrees with the mixer
+}
+
+var (
+	mixerStateMu sync.RWMutex
+	mixerPreamps = map[preampKey]*mixerPreamp{}
+)
+
+// recordMixerFrame stores a decoded frame in the mixer state table; source is "mixer" or "sent".
+func recordMixerFrame(f preampFrame, source string) {
+	mixerStateMu.Lock()
+	defer mixerStateMu.Unlock()
+	k := preampKey{f.Bus, f.Preamp}
+	p := mixerPreamps[k]
+	if p == nil {
+		p = &mixerPreamp{}
+		mixerPreamps[k] = p
+	}
+	switch f.Kind {
+	case "phantom":
+		on := f.On
+		p.Phantom, p.Sources.Phantom = &on, source
+	case "pad":
+		on := f.On
+		p.Pad, p.Sources.Pad = &on, source
+	case "gain":
+		db := f.GainDB
+		p.Gain, p.Sources.Gain = &db, source
+	}
+	p.Updated = time.Now()
+	p.Source = source
+}
+
+// differs lists the parameters whose known mixer value disagrees with the wanted one.
+func (p mixerPreamp) differs(phantom, pad bool, gain float64) []string {
+	var out []string
+	if p.Phantom != nil && *p.Phantom != phantom {
+		out = append(out, "phantom")
+	}
+	if p.Pad != nil && *p.Pad != pad {
+		out = append(out, "pad")
+	}
+	if p.Gain != nil && *p.Gain != math.Round(gain) { // the mixer only has 1 dB steps
+		out = append(out, "gain")
+	}
+	return out
+}
+
+// mixerHasValue reports whether the mixer is known to already have the value f would set.
+func mixerHasValue(f preampFrame) bool {
+	mixerStateMu.RLock()
+	defer mixerStateMu.RUnlock()
+	p := mixerPreamps[preampKey{f.Bus, f.Preamp}]
+	if p == nil {
+		return false
+	}
+	switch f.Kind {
+	case "phantom":
+		return p.Phantom != nil && *p.Phantom == f.On
+	case "pad":
+		return p.Pad != nil && *p.Pad == f.On
+	case "gain":
+		return p.Gain != nil && *p.Gain == f.GainDB
+	}
+	return false
+}
+
+// clearMixerPreamps forgets everything known about the mixer.
+func clearMixerPreamps() {
+	mixerStateMu.Lock()
+	defer mixerStateMu.Unlock()
+	mixerPreamps = map[preampKey]*mixerPreamp{}
+}
+
+// GetMixerPreamp returns a copy of the last known mixer values for one preamp.
+func GetMixerPreamp(bus string, preampId int) (mixerPreamp, bool) {
+	mixerStateMu.RLock()
+	defer mixerStateMu.RUnlock()
+	p := mixerPreamps[preampKey{bus, preampId}]
+	if p == nil {
+		return mixerPreamp{}, false
+	}
+	return *p, true
+}
+
+// GetMixerPreamps lists every preamp the mixer has reported, local before S-Link, by ID,
+// flagging parameters that differ from channels in state.
+func GetMixerPreamps() []mixerPreampView {
+	mixerStateMu.RLock()
+	out := make([]mixerPreampView, 0, len(mixerPreamps))
+	for k, p := range mixerPreamps {
+		out = append(out, mixerPreampView{Bus: k.Bus, PreampId: k.ID, mixerPreamp: *p})
+	}
+	mixerStateMu.RUnlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bus != out[j].Bus {
+			return out[i].Bus == "local"
+		}
+		return out[i].PreampId < out[j].PreampId
+	})
+	channels := GetState()
+	for i := range out {
+		v := &out[i]
+		for _, ch := range channels {
+			if ch.PreampBus != v.Bus || (ch.PreampId != v.PreampId && ch.PreampIdR != v.PreampId) {
+				continue
+			}
+			for _, param := range v.differs(ch.Phantom, ch.Pad, ch.Gain) {
+				v.Differs = appendUnique(v.Differs, param)
+			}
+		}
+	}
+	return out
+}
+
+func appendUnique(list []string, s string) []string {
+	for _, x := range list {
+		if x == s {
+			return list
+		}
+	}
+	return append(list, s)
+}
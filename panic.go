@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Emergency "all phantom off": every local (1–17) and S-Link (1–40) preamp, not only those in the channel
+// list. It pre-empts a running sync, drops queued sync traffic, sends at top priority and then re-sends until
+// the mixer state table shows phantom off on every preamp. Our own sends record "sent" values in that table,
+// so this does not prove the desk acted on them: it only stops once nothing (a sync finishing its preamp, a
+// desk report) has put phantom on again since. The phantom safety policy is not applied.
+
+const (
+	panicRounds       = 5
+	panicRetryBackoff = 200 * time.Millisecond // multiplied by the round number
+	panicSyncWait     = 5 * time.Second        // how long to wait for a cancelled sync to stop before confirming
+)
+
+var errPanicPreempted = errors.New("pre-empted by phantom panic")
+
+// panicMu makes concurrent panics run one after the other.
+var panicMu sync.Mutex
+
+type panicPreampResult struct {
+	preampKey
+	OK       bool   `json:"ok"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error,omitempty"`
+}
+
+func handlePostPanicPhantomOff(getAddr func(*gin.Context) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addr, ok := getAddr(c)
+		if !ok {
+			return
+		}
+		results, cancelledJob := runPhantomPanic(addr, auditOriginOf(c))
+		failed := 0
+		for _, r := range results {
+			if !r.OK {
+				failed++
+			}
+		}
+		out := gin.H{"preamps": results, "failed": failed}
+		if cancelledJob != "" {
+			out["cancelled_sync"] = cancelledJob
+		}
+		status := http.StatusOK
+		if failed > 0 {
+			status = http.StatusBadGateway
+		}
+		c.JSON(status, out)
+	}
+}
+
+// runPhantomPanic switches phantom off everywhere; returns per-preamp results and the cancelled sync job, if any.
+func runPhantomPanic(addr string, origin *auditOrigin) ([]panicPreampResult, string) {
+	panicMu.Lock()
+	defer panicMu.Unlock()
+	log.Printf("sqapi: PANIC phantom off on all preamps")
+	cancelledJob := cancelSync(errPanicPreempted)
+	scheduler.DropBulk(errPanicPreempted)
+
+	preamps := allPreamps()
+	results := make([]panicPreampResult, len(preamps))
+	for i, k := range preamps {
+		results[i].preampKey = k
+	}
+	for round := 1; round <= panicRounds; round++ {
+		if round == 2 {
+			// A pre-empted sync may still have a send in flight; confirm only once it has stopped.
+			waitSyncIdle(panicSyncWait)
+		}
+		var wg sync.WaitGroup
+		for i := range results {
+			r := &results[i]
+			if round > 1 && mixerHasValue(preampFrame{Bus: r.Bus, Preamp: r.ID, Kind: "phantom", On: false}) {
+				r.OK, r.Error = true, ""
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Attempts++
+				err := scheduler.Submit(mixerCmd{Addr: addr, Bus: r.Bus, Preamp: r.ID, Param: "phantom", Packet: buildPhantomBus(r.Bus, r.ID, false), Prio: prioPanic, Origin: origin})
+				if err != nil {
+					r.OK, r.Error = false, err.Error()
+					return
+				}
+				r.OK, r.Error = true, ""
+				LogTXPreamp(r.Bus, r.ID, "phantom", "off")
+			}()
+		}
+		wg.Wait()
+		if (round > 1 || cancelledJob == "") && allConfirmed(results) {
+			break
+		}
+		if round < panicRounds {
+			time.Sleep(time.Duration(round) * panicRetryBackoff)
+		}
+	}
+
+	var off []preampKey
+	for _, r := range results {
+		if r.OK {
+			off = append(off, r.preampKey)
+		}
+	}
+	UpdatePhantomMany(off, false)
+	return results, cancelledJob
+}
+
+// allConfirmed reports whether every preamp was sent ok and the mixer state table shows phantom off. That
+// value is normally the "sent" one our own send recorded, not a report from the desk.
+func allConfirmed(results []panicPreampResult) bool {
+	for _, r := range results {
+		if !r.OK || !mixerHasValue(preampFrame{Bus: r.Bus, Preamp: r.ID, Kind: "phantom", On: false}) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicStopsRunningSync(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	useTempDataDir(t)
+	pace := 20
+	setTestConfig(t, func(c *config) {
+		c.SyncPaceMS = &pace
+		c.PhantomSafety = &phantomSafety{Enabled: true, GainDB: 0, SettleMS: 10, StaggerMS: 100}
+	})
+	var channels []ChannelState
+	for id := 1; id <= 16; id++ {
+		channels = append(channels, ChannelState{ID: id, PreampBus: "local", PreampId: id, Phantom: true, Gain: 30})
+	}
+	if err := SetStateAndCurrentShow(channels, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	frames := watchSim(t, v)
+	postJSON(t, syncRouter(v), "/api/sync", `{"retries": 2}`, 202)
+	// Two preamps done (4 frames each with the dip), then into the third one's stagger wait before its phantom.
+	waitFor(t, func() bool { return len(frames()) >= 8 })
+	time.Sleep(40 * time.Millisecond)
+
+	results, job := runPhantomPanic(v.Addr(), nil)
+	if job == "" || !allConfirmed(results) {
+		t.Fatalf("panic: job %q, confirmed %v", job, allConfirmed(results))
+	}
+	if res := waitSyncResult(t); !res.Cancelled || len(res.Untouched) == 0 {
+		t.Errorf("sync result = %+v, want cancelled with untouched preamps", res)
+	}
+	time.Sleep(100 * time.Millisecond) // anything the sync still sent would have arrived by now
+
+	panicked := false
+	for _, f := range frames() {
+		if strings.HasSuffix(f, "phantom off") {
+			panicked = true
+		} else if panicked && strings.HasSuffix(f, "phantom on") {
+			t.Errorf("%s after the panic started", f)
+		}
+	}
+	for id := 1; id <= 16; id++ {
+		if p, _ := v.Preamp("local", id); p.Phantom {
+			t.Errorf("local %d phantom still on", id)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Debounced state persistence: preamp updates (UpdateGain/Phantom/Pad) only change memory and mark the state
+// dirty; a background persister writes state.json and history.json at most every statePersistInterval,
+// marshalling under a read lock and writing without holding stateMu. Explicit saves (POST /api/state, reset,
+// lock, undo) still write synchronously. FlushState writes pending changes now (shutdown, POST /api/state/flush).
+// Write failures are kept and reported by /api/state and /api/storage.
+
+const statePersistInterval = 250 * time.Millisecond
+
+var (
+	stateRev     uint64 // state revision: bumped on every change, saved in state.json; guarded by stateMu
+	persistWake  = make(chan struct{}, 1)
+	persistMu    sync.Mutex // serializes state writes; guards the fields below
+	persistedGen uint64     // revision last written
+	persistErr   *persistError
+)
+
+// persistError is the last failed state write; cleared by the next successful one.
+type persistError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// markStateDirtyLocked schedules a write of the changed state. Caller holds stateMu.
+func markStateDirtyLocked() {
+	stateRev++
+	select {
+	case persistWake <- struct{}{}:
+	default:
+	}
+}
+
+// stateSnapshotLocked marshals the state and history. Caller holds stateMu (read or write).
+func stateSnapshotLocked() (uint64, []byte, []byte, error) {
+	state, err := json.MarshalIndent(stateFile{Channels: stateChans, CurrentShow: stateCurrentShow, Revision: stateRev}, "", "  ")
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	hist, err := json.Marshal(historyFile{Undo: histUndo, Redo: histRedo})
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return stateRev, state, hist, nil
+}
+
+// writeStateSnapshot writes a snapshot unless a newer one has been written already.
+func writeStateSnapshot(gen uint64, state, hist []byte) error {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+	if gen <= persistedGen {
+		return nil
+	}
+	err := ensureDataDir()
+	for attempt := 0; err == nil && attempt < saveStateRetries; attempt++ {
+		if err = writeFileAtomic(statePath(), state, 0644, true); err == nil {
+			break
+		}
+		if attempt < saveStateRetries-1 {
+			err = nil
+			time.Sleep(saveStateBackoff)
+		}
+	}
+	if err != nil {
+		log.Printf("sqapi: save state failed after %d attempts: %v", saveStateRetries, err)
+		persistErr = &persistError{Time: time.Now(), Error: err.Error()}
+		return err
+	}
+	if err := writeFileAtomic(historyPath(), hist, 0644, false); err != nil {
+		log.Printf("sqapi: save history: %v", err)
+	}
+	persistedGen, persistErr = gen, nil
+	return nil
+}
+
+// FlushState writes pending state changes now.
+func FlushState() error {
+	stateMu.RLock()
+	gen, state, hist, err := stateSnapshotLocked()
+	stateMu.RUnlock()
+	if err != nil {
+		return err
+	}
+	return writeStateSnapshot(gen, state, hist)
+}
+
+// GetPersistError returns the last failed state write, or nil.
+func GetPersistError() *persistError {
+	persistMu.Lock()
+	defer persistMu.Unlock()
+	return persistErr
+}
+
+// startStatePersister runs the background writer.
+func startStatePersister() {
+	go func() {
+		for range persistWake {
+			time.Sleep(statePersistInterval) // let a burst of slider steps collect
+			_ = FlushState()
+		}
+	}()
+}
+
+// handlePostStateFlush writes pending state changes and reports the result.
+func handlePostStateFlush(c *gin.Context) {
+	if err := FlushState(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"flushed": true})
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// savedGain reads the gain of the first channel from state.json.
+func savedGain(t *testing.T) float64 {
+	t.Helper()
+	b, err := os.ReadFile(statePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f stateFile
+	if err := json.Unmarshal(b, &f); err != nil || len(f.Channels) == 0 {
+		t.Fatalf("state.json: %v %s", err, b)
+	}
+	return f.Channels[0].Gain
+}
+
+func TestStatePersister(t *testing.T) {
+	dir := useTempDataDir(t)
+	if err := SetStateAndCurrentShow([]ChannelState{{ID: 1, PreampBus: "local", PreampId: 1, Gain: 10}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Preamp updates only mark the state dirty; a flush writes them.
+	UpdateGain("local", 1, 20)
+	if g := savedGain(t); g != 10 {
+		t.Fatalf("saved gain %v before flush, want 10", g)
+	}
+	if err := FlushState(); err != nil || savedGain(t) != 20 {
+		t.Fatalf("after flush: %v, gain %v", err, savedGain(t))
+	}
+
+	// An older snapshot never overwrites a newer one.
+	UpdateGain("local", 1, 30)
+	stateMu.RLock()
+	oldGen, oldState, oldHist, _ := stateSnapshotLocked()
+	stateMu.RUnlock()
+	UpdateGain("local", 1, 40)
+	if err := FlushState(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStateSnapshot(oldGen, oldState, oldHist); err != nil || savedGain(t) != 40 {
+		t.Errorf("stale snapshot: %v, gain %v, want 40", err, savedGain(t))
+	}
+
+	// A failed write is reported until the next one succeeds.
+	blocked := filepath.Join(dir, "file")
+	if err := os.WriteFile(blocked, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	configMu.Lock()
+	dataDir = blocked // not a directory
+	configMu.Unlock()
+	UpdateGain("local", 1, 50)
+	if err := FlushState(); err == nil || GetPersistError() == nil {
+		t.Fatalf("write into a file: err %v, persist error %v", err, GetPersistError())
+	}
+	configMu.Lock()
+	dataDir = dir
+	configMu.Unlock()
+	if err := FlushState(); err != nil || GetPersistError() != nil || savedGain(t) != 50 {
+		t.Errorf("after recovery: %v, persist error %v, gain %v", err, GetPersistError(), savedGain(t))
+	}
+}
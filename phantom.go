@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Pop-safe phantom switching: with the policy enabled, a phantom change on a preamp is done as
+// gain down to the safe value → phantom → settle → gain back, and phantom switches on different preamps are
+// spaced by the stagger time. Preamps whose phantom the mixer is known to already have are switched directly.
+
+// phantomSafety is the policy in config.json ("phantom_safety").
+type phantomSafety struct {
+	Enabled   bool    `json:"enabled"`
+	GainDB    float64 `json:"gain_db"`    // gain while phantom switches
+	SettleMS  int     `json:"settle_ms"`  // wait after switching before gain is restored
+	StaggerMS int     `json:"stagger_ms"` // minimum gap between phantom switches on different preamps
+}
+
+var defaultPhantomSafety = phantomSafety{Enabled: true, GainDB: 0, SettleMS: 500, StaggerMS: 200}
+
+// bypassPhantomSafety reports whether a request asks to switch phantom directly (?bypass_phantom_safety=1).
+func bypassPhantomSafety(c *gin.Context) bool {
+	v := c.Query("bypass_phantom_safety")
+	return v == "1" || v == "true"
+}
+
+// phantomPolicy is the policy for a request: the configured one, disabled if the request bypasses it.
+func phantomPolicy(c *gin.Context) phantomSafety {
+	p := GetPhantomSafety()
+	if bypassPhantomSafety(c) {
+		p.Enabled = false
+	}
+	return p
+}
+
+func (p phantomSafety) validate() error {
+	if p.GainDB < gainDBMin || p.GainDB > gainDBMax {
+		return fmt.Errorf("phantom_safety.gain_db must be %d..%d", gainDBMin, gainDBMax)
+	}
+	if p.SettleMS < 0 || p.SettleMS > 10000 || p.StaggerMS < 0 || p.StaggerMS > 10000 {
+		return fmt.Errorf("phantom_safety settle_ms and stagger_ms must be 0..10000")
+	}
+	return nil
+}
+
+func (p phantomSafety) settle() time.Duration  { return time.Duration(p.SettleMS) * time.Millisecond }
+func (p phantomSafety) stagger() time.Duration { return time.Duration(p.StaggerMS) * time.Millisecond }
+
+// phantomChanges reports whether switching bus/preamp to on may change it (unknown counts as a change).
+func phantomChanges(bus string, preamp int, on bool) bool {
+	return !mixerHasValue(preampFrame{Bus: bus, Preamp: preamp, Kind: "phantom", On: on})
+}
+
+var (
+	phantomGateMu   sync.Mutex
+	phantomLastSwap time.Time
+)
+
+// waitPhantomStagger blocks until at least d has passed since the previous phantom switch on any preamp.
+func waitPhantomStagger(d time.Duration) {
+	phantomGateMu.Lock()
+	defer phantomGateMu.Unlock()
+	if wait := time.Until(phantomLastSwap.Add(d)); wait > 0 {
+		time.Sleep(wait)
+	}
+	phantomLastSwap = time.Now()
+}
+
+// gainCmd is a plain gain command for cmd's preamp with the same address, priority, origin and context.
+func gainCmd(cmd mixerCmd, db float64) mixerCmd {
+	return mixerCmd{Addr: cmd.Addr, Bus: cmd.Bus, Preamp: cmd.Preamp, Param: "gain", Packet: buildGainBus(cmd.Bus, cmd.Preamp, db), Prio: cmd.Prio, Origin: cmd.Origin, ctx: cmd.ctx}
+}
+
+// needsDip reports whether a phantom switch on bus/preamp needs the gain dip: only a gain the mixer is known
+// to have at or below the safe value skips it. State or target gains say nothing about the desk.
+func needsDip(bus string, preamp int, policy phantomSafety) bool {
+	p, ok := GetMixerPreamp(bus, preamp)
+	return !ok || p.Gain == nil || *p.Gain > policy.GainDB
+}
+
+// phantomDip sends the safe gain before the phantom command cmd; false if the preamp is known to be at or
+// below it already.
+func phantomDip(cmd mixerCmd, policy phantomSafety) (bool, error) {
+	if !needsDip(cmd.Bus, cmd.Preamp, policy) {
+		return false, nil
+	}
+	err := scheduler.Submit(gainCmd(cmd, policy.GainDB))
+	return err == nil, err
+}
+
+// switchPhantomSafely sends the phantom command cmd following the policy; gain is the preamp's gain to
+// restore afterwards.
+func switchPhantomSafely(cmd mixerCmd, on bool, gain float64, policy phantomSafety) error {
+	if !policy.Enabled || !phantomChanges(cmd.Bus, cmd.Preamp, on) {
+		return scheduler.Submit(cmd)
+	}
+	waitPhantomStagger(policy.stagger())
+	dipped, err := phantomDip(cmd, policy)
+	if err != nil {
+		return err
+	}
+	if err := scheduler.Submit(cmd); err != nil {
+		return err
+	}
+	if !dipped {
+		return nil
+	}
+	time.Sleep(policy.settle())
+	return scheduler.Submit(gainCmd(cmd, gain))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPhantomSafetyDipsUnknownGain(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	setTestConfig(t, func(c *config) { c.PhantomSafety = &phantomSafety{Enabled: true, GainDB: 0, SettleMS: 20} })
+	frames := watchSim(t, v)
+
+	// The app has never seen local 3's gain: the switch dips anyway, then restores.
+	cmd := mixerCmd{Addr: v.Addr(), Bus: "local", Preamp: 3, Param: "phantom", Packet: buildPhantom(3, true), Prio: prioInteractive}
+	if err := switchPhantomSafely(cmd, true, 50, GetPhantomSafety()); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"local 3 gain 0 dB", "local 3 phantom on", "local 3 gain 50 dB"}
+	waitFor(t, func() bool { return len(frames()) >= len(want) })
+	if got := frames(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("frames = %q, want %q", got, want)
+	}
+
+	// The mixer reported a gain at the safe value: no dip.
+	recordMixerFrame(preampFrame{Bus: "local", Preamp: 4, Kind: "gain", GainDB: 0}, "mixer")
+	cmd = mixerCmd{Addr: v.Addr(), Bus: "local", Preamp: 4, Param: "phantom", Packet: buildPhantom(4, true), Prio: prioInteractive}
+	if err := switchPhantomSafely(cmd, true, 0, GetPhantomSafety()); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "local 4 phantom on")
+	waitFor(t, func() bool { return len(frames()) >= len(want) })
+	if got := frames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+}
+
+func TestSyncPhantomDipOrder(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	useTempDataDir(t)
+	setTestConfig(t, func(c *config) { c.PhantomSafety = &phantomSafety{Enabled: true, GainDB: 0, SettleMS: 20} })
+	if err := SetStateAndCurrentShow([]ChannelState{{ID: 1, PreampBus: "slink", PreampId: 2, Phantom: true, Gain: 40}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	frames := watchSim(t, v)
+	postJSON(t, syncRouter(v), "/api/sync", `{}`, 202)
+	if res := waitSyncResult(t); res.Synced != 1 {
+		t.Fatalf("result = %+v", res)
+	}
+	want := []string{"slink 2 gain 0 dB", "slink 2 phantom on", "slink 2 pad off", "slink 2 gain 40 dB"}
+	waitFor(t, func() bool { return len(frames()) >= len(want) })
+	if got := frames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+}
+
+func TestPhantomPolicyDefaultAndBypass(t *testing.T) {
+	setTestConfig(t, func(c *config) { c.PhantomSafety = nil })
+	ctx := func(target string) *gin.Context {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("POST", target, nil)
+		return c
+	}
+	if p := phantomPolicy(ctx("/preamp/local/1/phantom?on=1")); !p.Enabled || p.StaggerMS == 0 {
+		t.Errorf("default policy = %+v, want enabled with a stagger", p)
+	}
+	if p := phantomPolicy(ctx("/preamp/local/1/phantom?on=1&bypass_phantom_safety=1")); p.Enabled {
+		t.Error("bypass_phantom_safety=1 left the policy enabled")
+	}
+	if req, ok := bindSyncRequest(ctx("/api/sync?bypass_phantom_safety=true")); !ok || !req.BypassPhantomSafety {
+		t.Error("sync ignores ?bypass_phantom_safety")
+	}
+}
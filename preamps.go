@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Preamp-centric view of the channel list: GET /api/preamps lists local 1–21 and S-Link 1–40 with the
+// channels using each one, the values state wants, the last values sent to or read from the mixer, and
+// conflicts where channels sharing a preamp want different settings.
+
+type preampValues struct {
+	Phantom bool    `json:"phantom"`
+	Pad     bool    `json:"pad"`
+	Gain    float64 `json:"gain"`
+}
+
+type preampView struct {
+	Bus      string        `json:"bus"`
+	PreampId int           `json:"preampId"`
+	Line     bool          `json:"line"`     // local 18–21: stereo line input, never sent to the mixer
+	Channels []int         `json:"channels"` // IDs of the channels using it (L or R)
+	Desired  *preampValues `json:"desired,omitempty"`
+	Mixer    *mixerPreamp  `json:"mixer,omitempty"`     // last value sent or read per parameter; nil = nothing known
+	Differs  []string      `json:"differs,omitempty"`   // parameters where the mixer disagrees with desired
+	Conflict []string      `json:"conflicts,omitempty"` // parameters the channels disagree on
+}
+
+// listPreampViews builds the view for every preamp from channels and the mixer state table. With channels in
+// conflict, desired is what sync leaves on the preamp: the last channel in the list wins.
+func listPreampViews(channels []ChannelState) []preampView {
+	var keys []preampKey
+	for id := localPreampMin; id <= localPreampMax; id++ {
+		keys = append(keys, preampKey{"local", id})
+	}
+	for _, id := range localLinePreampIDs {
+		keys = append(keys, preampKey{"local", id})
+	}
+	for id := slinkPreampMin; id <= slinkPreampMax; id++ {
+		keys = append(keys, preampKey{"slink", id})
+	}
+
+	out := make([]preampView, 0, len(keys))
+	for _, k := range keys {
+		v := preampView{Bus: k.Bus, PreampId: k.ID, Line: k.Bus == "local" && isLocalLinePreamp(k.ID), Channels: []int{}}
+		for _, ch := range channels {
+			if !ch.usesPreamp(k.Bus, k.ID) {
+				continue
+			}
+			v.Channels = append(v.Channels, ch.ID)
+			if v.Line {
+				continue
+			}
+			want := preampValues{Phantom: ch.Phantom, Pad: ch.Pad, Gain: ch.Gain}
+			if d := v.Desired; d != nil {
+				if d.Phantom != want.Phantom {
+					v.Conflict = appendUnique(v.Conflict, "phantom")
+				}
+				if d.Pad != want.Pad {
+					v.Conflict = appendUnique(v.Conflict, "pad")
+				}
+				if d.Gain != want.Gain {
+					v.Conflict = appendUnique(v.Conflict, "gain")
+				}
+			}
+			v.Desired = &want
+		}
+		if p, ok := GetMixerPreamp(k.Bus, k.ID); ok {
+			v.Mixer = &p
+			if d := v.Desired; d != nil {
+				v.Differs = p.differs(d.Phantom, d.Pad, d.Gain)
+			}
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func handleGetPreamps(c *gin.Context) {
+	channels, _, rev := GetStateSnapshot()
+	c.JSON(http.StatusOK, gin.H{"preamps": listPreampViews(channels), "revision": rev})
+}
@@ -0,0 +1,25 @@
+package main
+
+import "testing"
+
+func TestListPreampViews(t *testing.T) {
+	channels := []ChannelState{
+		{ID: 1, PreampBus: "slink", PreampId: 5, PreampIdR: 6, Gain: 20},
+		{ID: 2, PreampBus: "slink", PreampId: 6, Gain: 30, Phantom: true}, // shares S-Link 6 with channel 1
+		{ID: 3, PreampBus: "local", PreampId: 18, PreampIdR: 19},
+	}
+	views := listPreampViews(channels)
+	if len(views) != 21+40 {
+		t.Fatalf("%d preamps, want 61", len(views))
+	}
+	if v := views[17]; v.Bus != "local" || v.PreampId != 18 || !v.Line || len(v.Channels) != 1 || v.Desired != nil {
+		t.Errorf("line input = %+v", v)
+	}
+	s5, s6 := views[21+4], views[21+5]
+	if len(s5.Channels) != 1 || s5.Conflict != nil || s5.Desired.Gain != 20 {
+		t.Errorf("S-Link 5 = %+v", s5)
+	}
+	if len(s6.Channels) != 2 || len(s6.Conflict) != 2 || s6.Desired.Gain != 30 {
+		t.Errorf("S-Link 6 = %+v (conflicts %v)", s6, s6.Conflict)
+	}
+}
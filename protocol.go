@@ -1,6 +1,10 @@
 package main
 
-import "math"
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
 
 // Packet format (TCP 51326): F7 0C 0C [subtype] [ch] [block] [v1] [v2]
 // Only these ranges are sent to the mixer: local 1–16 + 17 (talkback), S-Link 1–40, gain 0–60.
@@ -114,3 +118,151 @@ func buildPadSLink(slinkPreamp int, on bool) []byte {
 func buildGainSLink(slinkPreamp int, dB float64) []byte {
 	return buildGainCh(slinkPreampToCh(slinkPreamp), blockSLink, dB)
 }
+
+// By bus name ("local" | "slink"), for code that handles both.
+func buildPhantomBus(bus string, preamp int, on bool) []byte {
+	if bus == "slink" {
+		return buildPhantomSLink(preamp, on)
+	}
+	return buildPhantom(preamp, on)
+}
+
+func buildPadBus(bus string, preamp int, on bool) []byte {
+	if bus == "slink" {
+		return buildPadSLink(preamp, on)
+	}
+	return buildPad(preamp, on)
+}
+
+func buildGainBus(bus string, preamp int, dB float64) []byte {
+	if bus == "slink" {
+		return buildGainSLink(preamp, dB)
+	}
+	return buildGain(preamp, dB)
+}
+
+// Decoding: exact inverse of the builders above, used for frames the SQ sends back.
+
+const frameLen = 8
+
+var frameHeader = []byte{0xF7, 0x0C, 0x0C}
+
+// preampFrame is one decoded F7 0C 0C packet.
+type preampFrame struct {
+	Bus    string  // "local" | "slink"
+	Preamp int     // local 1–17, S-Link 1–40
+	Kind   string  // "phantom" | "pad" | "gain"
+	On     bool    // phantom / pad
+	GainDB float64 // gain
+}
+
+// busLabel is how logs name a bus: "local" or "S-Link".
+func busLabel(bus string) string {
+	if bus == "slink" {
+		return "S-Link"
+	}
+	return "local"
+}
+
+// value is the frame's value as logs and the audit trail show it: "on"/"off" or "12 dB".
+func (f preampFrame) value() string {
+	if f.Kind == "gain" {
+		return fmt.Sprintf("%.0f dB", f.GainDB)
+	}
+	return boolToOnOff(f.On)
+}
+
+// String renders the frame as "S-Link preamp 12 gain 30 dB".
+func (f preampFrame) String() string {
+	return fmt.Sprintf("%s preamp %d %s %s", busLabel(f.Bus), f.Preamp, f.Kind, f.value())
+}
+
+func chToLocalPreamp(ch byte) (int, bool) {
+	if ch == 58 {
+		return 17, true // talkback
+	}
+	if int(ch) <= localPreampMax-2 {
+		return int(ch) + 1, true
+	}
+	return 0, false
+}
+
+func chToSLinkPreamp(ch byte) (int, bool) {
+	if int(ch) <= slinkPreampMax-1 {
+		return int(ch) + 1, true
+	}
+	return 0, false
+}
+
+func gainRawToDB(raw uint16) float64 {
+	if raw < gainRaw0dB {
+		raw = gainRaw0dB
+	}
+	if raw > gainRaw60dB {
+		raw = gainRaw60dB
+	}
+	return float64(raw-gainRaw0dB) * 60 / float64(gainRaw60dB-gainRaw0dB)
+}
+
+func parseFrame(b []byte) (preampFrame, error) {
+	var f preampFrame
+	if len(b) != frameLen || !bytes.HasPrefix(b, frameHeader) {
+		return f, fmt.Errorf("not an F7 0C 0C frame (%d bytes)", len(b))
+	}
+	var ok bool
+	switch b[5] {
+	case blockLocal:
+		f.Bus = "local"
+		f.Preamp, ok = chToLocalPreamp(b[4])
+	case blockSLink:
+		f.Bus = "slink"
+		f.Preamp, ok = chToSLinkPreamp(b[4])
+	default:
+		return f, fmt.Errorf("unknown block %02X", b[5])
+	}
+	if !ok {
+		return f, fmt.Errorf("unknown %s ch %d", f.Bus, b[4])
+	}
+	switch b[3] {
+	case subtypePhantom:
+		f.Kind, f.On = "phantom", b[6] != 0
+	case subtypePad:
+		f.Kind, f.On = "pad", b[6] != 0
+	case subtypeGain:
+		f.Kind, f.GainDB = "gain", gainRawToDB(uint16(b[6])<<8|uint16(b[7]))
+	default:
+		return f, fmt.Errorf("unknown subtype %02X", b[3])
+	}
+	return f, nil
+}
+
+// splitFrames cuts a TCP byte stream into chunks: each chunk is either one 8-byte F7 0C 0C frame
+// or a run of bytes that is not one. rest is an incomplete frame (or partial header) to prepend to the next read.
+func splitFrames(buf []byte) (chunks [][]byte, rest []byte) {
+	for len(buf) > 0 {
+		i := bytes.Index(buf, frameHeader)
+		if i < 0 {
+			keep := 0
+			for k := len(frameHeader) - 1; k > 0; k-- {
+				if bytes.HasSuffix(buf, frameHeader[:k]) {
+					keep = k
+					break
+				}
+			}
+			if len(buf) > keep {
+				chunks = append(chunks, buf[:len(buf)-keep])
+			}
+			return chunks, buf[len(buf)-keep:]
+		}
+		if i > 0 {
+			chunks = append(chunks, buf[:i])
+			buf = buf[i:]
+		}
+		if len(buf) < frameLen {
+			return chunks, buf
+		}
+		chunks = append(chunks, buf[:frameLen])
+		buf = buf[frameLen:]
+	}
+	return chunks, nil
+}
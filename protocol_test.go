@@ -122,3 +122,62 @@ func TestClampOutOfRange(t *testing.T) {
 		t.Errorf("gain 100 clamped: raw = %04X, want %04X", v, gainRaw60dB)
 	}
 }
+
+func TestParseFrameRoundTrip(t *testing.T) {
+	for id := localPreampMin; id <= localPreampMax; id++ {
+		f, err := parseFrame(buildPhantom(id, true))
+		if err != nil || f.Bus != "local" || f.Preamp != id || f.Kind != "phantom" || !f.On {
+			t.Errorf("local %d phantom: %+v, %v", id, f, err)
+		}
+	}
+	for id := slinkPreampMin; id <= slinkPreampMax; id++ {
+		f, err := parseFrame(buildPadSLink(id, false))
+		if err != nil || f.Bus != "slink" || f.Preamp != id || f.Kind != "pad" || f.On {
+			t.Errorf("slink %d pad: %+v, %v", id, f, err)
+		}
+	}
+	for db := gainDBMin; db <= gainDBMax; db++ {
+		f, err := parseFrame(buildGain(17, float64(db)))
+		if err != nil || f.Preamp != 17 || f.Kind != "gain" || f.GainDB != float64(db) {
+			t.Errorf("gain %d dB: %+v, %v", db, f, err)
+		}
+	}
+}
+
+func TestParseFrameUnknown(t *testing.T) {
+	bad := [][]byte{
+		{0xF7, 0x0C, 0x0C, 0x0F, 0x00, 0x01, 0x00, 0x00},            // unknown subtype
+		{0xF7, 0x0C, 0x0C, subtypeGain, 0x00, 0x03, 0x00, 0x80},     // unknown block
+		{0xF7, 0x0C, 0x0C, subtypeGain, 16, blockLocal, 0x00, 0x80}, // local ch between inputs and talkback
+		{0xF7, 0x0C, 0x0C, subtypeGain, 40, blockSLink, 0x00, 0x80}, // S-Link 41
+		{0xF7, 0x0C, 0x0C, subtypeGain},                             // short
+	}
+	for _, b := range bad {
+		if f, err := parseFrame(b); err == nil {
+			t.Errorf("parseFrame(% X) = %+v, want error", b, f)
+		}
+	}
+}
+
+func TestSplitFrames(t *testing.T) {
+	a := buildPhantom(1, true)
+	b := buildGainSLink(3, 20)
+	stream := append([]byte{0x01, 0x02}, a...)
+	stream = append(stream, b[:5]...)
+	chunks, rest := splitFrames(stream)
+	if len(chunks) != 2 || !bytes.Equal(chunks[0], []byte{0x01, 0x02}) || !bytes.Equal(chunks[1], a) {
+		t.Fatalf("chunks = % X", chunks)
+	}
+	if !bytes.Equal(rest, b[:5]) {
+		t.Fatalf("rest = % X, want % X", rest, b[:5])
+	}
+	chunks, rest = splitFrames(append(rest, b[5:]...))
+	if len(chunks) != 1 || !bytes.Equal(chunks[0], b) || len(rest) != 0 {
+		t.Errorf("second read: chunks = % X rest = % X", chunks, rest)
+	}
+	// Partial header at the tail is kept for the next read
+	chunks, rest = splitFrames([]byte{0xAA, 0xF7, 0x0C})
+	if len(chunks) != 1 || !bytes.Equal(rest, []byte{0xF7, 0x0C}) {
+		t.Errorf("partial header: chunks = % X rest = % X", chunks, rest)
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Protocol sniffer: `sqapi proxy` sits between SQ-MixPad (or any client) and the mixer, forwards bytes
+// unchanged and logs every frame in both directions. Known preamp frames are decoded, anything else is
+// hex-dumped. With -capture, frames are also written as JSON lines that `sqapi replay` reads back.
+
+// Capture directions.
+const (
+	dirToMixer   = "c2m" // client → mixer
+	dirFromMixer = "m2c" // mixer → client
+)
+
+// captureRecord is one line of a capture file.
+type captureRecord struct {
+	Time time.Time `json:"t"`
+	Conn int       `json:"conn"` // client connection number, from 1
+	Dir  string    `json:"dir"`
+	Hex  string    `json:"hex"`
+}
+
+// describeChunk renders one chunk from splitFrames for the log.
+func describeChunk(chunk []byte) string {
+	f, err := parseFrame(chunk)
+	if err != nil {
+		return fmt.Sprintf("% X  (%v)", chunk, err)
+	}
+	return fmt.Sprintf("% X  %s", chunk, f)
+}
+
+type captureWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (w *captureWriter) write(rec captureRecord) {
+	if w == nil {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.enc.Encode(rec); err != nil {
+		log.Printf("sqapi proxy: capture: %v", err)
+	}
+}
+
+// pipeFrames copies src to dst unchanged and logs/captures what went through.
+func pipeFrames(dst io.Writer, src io.Reader, connID int, dir string, capture *captureWriter) error {
+	buf := make([]byte, 4096)
+	var pending []byte
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			now := time.Now()
+			var chunks [][]byte
+			chunks, pending = splitFrames(append(pending, buf[:n]...))
+			for _, chunk := range chunks {
+				log.Printf("sqapi proxy: #%d %s %s", connID, dir, describeChunk(chunk))
+				capture.write(captureRecord{Time: now, Conn: connID, Dir: dir, Hex: hex.EncodeToString(chunk)})
+			}
+			pending = append([]byte(nil), pending...)
+		}
+		if err != nil {
+			if len(pending) > 0 {
+				log.Printf("sqapi proxy: #%d %s % X  (incomplete)", connID, dir, pending)
+				capture.write(captureRecord{Time: time.Now(), Conn: connID, Dir: dir, Hex: hex.EncodeToString(pending)})
+			}
+			return err
+		}
+	}
+}
+
+func proxyConn(client net.Conn, mixerAddr string, connID int, capture *captureWriter) {
+	defer client.Close()
+	upstream, err := net.DialTimeout("tcp", mixerAddr, sqTimeout)
+	if err != nil {
+		log.Printf("sqapi proxy: #%d dial %s: %v", connID, mixerAddr, err)
+		return
+	}
+	defer upstream.Close()
+	log.Printf("sqapi proxy: #%d %s <-> %s", connID, client.RemoteAddr(), mixerAddr)
+	done := make(chan struct{}, 2)
+	go func() {
+		_ = pipeFrames(upstream, client, connID, dirToMixer, capture)
+		done <- struct{}{}
+	}()
+	go func() {
+		_ = pipeFrames(client, upstream, connID, dirFromMixer, capture)
+		done <- struct{}{}
+	}()
+	<-done // either side closing ends the session
+	log.Printf("sqapi proxy: #%d closed", connID)
+}
+
+// withSQPort adds the SQ port to a bare host.
+func withSQPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, sqPort)
+}
+
+// runProxy is the `sqapi proxy` subcommand.
+func runProxy(args []string) {
+	sqip, _, _ := LoadConfig()
+	fs := flag.NewFlagSet("proxy", flag.ExitOnError)
+	listen := fs.String("listen", ":"+sqPort, "address SQ-MixPad connects to")
+	mixerAddr := fs.String("mixer", sqip, "real mixer IP (default: sq_ip from config.json)")
+	capturePath := fs.String("capture", "", "append frames to this JSON-lines file for `sqapi replay`")
+	_ = fs.Parse(args)
+	if strings.TrimSpace(*mixerAddr) == "" {
+		log.Fatalf("sqapi proxy: no mixer address: set -mixer or sq_ip in config.json")
+	}
+	upstream := withSQPort(strings.TrimSpace(*mixerAddr))
+
+	var capture *captureWriter
+	if *capturePath != "" {
+		f, err := os.OpenFile(*capturePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			log.Fatalf("sqapi proxy: capture: %v", err)
+		}
+		defer f.Close()
+		capture = &captureWriter{enc: json.NewEncoder(f)}
+	}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		log.Fatalf("sqapi proxy: listen: %v", err)
+	}
+	log.Printf("sqapi proxy: %s -> %s", ln.Addr(), upstream)
+	for connID := 1; ; connID++ {
+		client, err := ln.Accept()
+		if err != nil {
+			log.Fatalf("sqapi proxy: accept: %v", err)
+		}
+		go proxyConn(client, upstream, connID, capture)
+	}
+}
+
+// runReplay is the `sqapi replay` subcommand: prints a capture file decoded and can resend the
+// client→mixer frames to a mixer or the simulator.
+func runReplay(args []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	to := fs.String("to", "", "resend client→mixer frames to this mixer IP (e.g. 127.0.0.1 for sqapi simulate)")
+	realtime := fs.Bool("realtime", false, "keep the original timing between frames when resending")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatalf("usage: sqapi replay [-to ip] [-realtime] capture.jsonl")
+	}
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatalf("sqapi replay: %v", err)
+	}
+	defer f.Close()
+
+	var conn net.Conn
+	if *to != "" {
+		conn, err = net.DialTimeout("tcp", withSQPort(*to), sqTimeout)
+		if err != nil {
+			log.Fatalf("sqapi replay: %v", err)
+		}
+		defer conn.Close()
+	}
+	var last time.Time
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		var rec captureRecord
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			log.Printf("sqapi replay: line %d: %v", line, err)
+			continue
+		}
+		b, err := hex.DecodeString(rec.Hex)
+		if err != nil {
+			log.Printf("sqapi replay: line %d: %v", line, err)
+			continue
+		}
+		fmt.Printf("%s #%d %s %s\n", rec.Time.Format("15:04:05.000"), rec.Conn, rec.Dir, describeChunk(b))
+		if conn == nil || rec.Dir != dirToMixer {
+			continue
+		}
+		if *realtime && !last.IsZero() && rec.Time.After(last) {
+			time.Sleep(rec.Time.Sub(last))
+		}
+		last = rec.Time
+		if _, err := conn.Write(b); err != nil {
+			log.Fatalf("sqapi replay: write: %v", err)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		log.Fatalf("sqapi replay: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Reverse sync: capture preamp settings from the mixer into state.
+// There is no known request frame for reading a preamp, so the pull listens: values come from the
+// mixer state table (mixerstate.go), which the reader loop fills from whatever the SQ sends. Nothing is
+// queried. Only values the mixer reported are taken; values we sent ourselves are not proof of what the desk has.
+
+var (
+	pullMu         sync.Mutex
+	pullStatus     string // "idle" | "running"
+	pullCurrent    int    // preamps with all of phantom/pad/gain known
+	pullTotal      int
+	pullLastResult *pullResult
+)
+
+type pullResult struct {
+	Method   string         `json:"method"`              // always "passive": nothing is queried, see above
+	Note     string         `json:"note,omitempty"`      // set when preamps are missing: why
+	Pulled   int            `json:"pulled"`              // preamps written into channel state
+	Missing  []preampKey    `json:"missing,omitempty"`   // no value seen before the wait ran out
+	SentOnly []preampKey    `json:"sent_only,omitempty"` // some values known only from our own sends, not taken
+	Locked   []preampKey    `json:"locked,omitempty"`    // used by a locked channel, left alone (lock.go)
+	Preamps  []pulledPreamp `json:"preamps,omitempty"`   // scope "all": every preamp with the values seen
+	Error    string         `json:"error,omitempty"`
+}
+
+type pulledPreamp struct {
+	preampKey
+	mixerPreamp
+	Channels []int `json:"channels,omitempty"` // channel IDs updated from this preamp
+}
+
+const defaultPullWait = 2 * time.Second
+
+const pullMissingNote = "the pull only hears values the desk sends when a preamp changes (console, SQ-MixPad) " +
+	"since the app connected; nothing is queried, so move the missing preamps on the desk and pull again"
+
+// referencedPreamps returns the preamps the channel list points at (L and R), in channel order, without
+// duplicates and without local line inputs.
+func referencedPreamps(channels []ChannelState) []preampKey {
+	var out []preampKey
+	seen := map[preampKey]bool{}
+	for _, ch := range channels {
+		bus := ch.PreampBus
+		if bus != "local" && bus != "slink" {
+			bus = "local"
+		}
+		for _, id := range []int{ch.PreampId, ch.PreampIdR} {
+			if id == 0 || (bus == "local" && isLocalLinePreamp(id)) {
+				continue
+			}
+			k := preampKey{bus, id}
+			if !seen[k] {
+				seen[k] = true
+				out = append(out, k)
+			}
+		}
+	}
+	return out
+}
+
+// allPreamps returns every preamp the mixer accepts commands for: local 1–17 then S-Link 1–40.
+func allPreamps() []preampKey {
+	var out []preampKey
+	for id := localPreampMin; id <= localPreampMax; id++ {
+		out = append(out, preampKey{"local", id})
+	}
+	for id := slinkPreampMin; id <= slinkPreampMax; id++ {
+		out = append(out, preampKey{"slink", id})
+	}
+	return out
+}
+
+// handlePostPull starts a pull in the background; returns 202 immediately.
+// Body (optional): {"scope": "channels" | "all", "wait_ms": 2000}.
+func handlePostPull(getAddr func(*gin.Context) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Scope  string `json:"scope"`
+			WaitMS int    `json:"wait_ms"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if body.Scope == "" {
+			body.Scope = "channels"
+		}
+		if body.Scope != "channels" && body.Scope != "all" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "scope must be channels or all"})
+			return
+		}
+		wait := defaultPullWait
+		if body.WaitMS > 0 {
+			wait = time.Duration(body.WaitMS) * time.Millisecond
+		}
+		addr, ok := getAddr(c)
+		if !ok {
+			return
+		}
+		targets := referencedPreamps(GetState())
+		if body.Scope == "all" {
+			targets = allPreamps()
+		}
+		pullMu.Lock()
+		if pullStatus == "running" {
+			pullMu.Unlock()
+			c.JSON(http.StatusConflict, gin.H{"error": "pull already in progress"})
+			return
+		}
+		pullStatus = "running"
+		pullCurrent = 0
+		pullTotal = len(targets)
+		pullLastResult = nil
+		pullMu.Unlock()
+
+		go runPullInBackground(addr, targets, body.Scope == "all", wait)
+		c.JSON(http.StatusAccepted, gin.H{"started": true, "total": len(targets)})
+	}
+}
+
+func runPullInBackground(addr string, targets []preampKey, reportAll bool, wait time.Duration) {
+	defer func() {
+		pullMu.Lock()
+		pullStatus = "idle"
+		pullMu.Unlock()
+	}()
+
+	if err := mixer.Connect(addr); err != nil {
+		pullMu.Lock()
+		pullLastResult = &pullResult{Method: "passive", Error: err.Error()}
+		pullMu.Unlock()
+		return
+	}
+	deadline := time.Now().Add(wait)
+	for {
+		complete := 0
+		for _, k := range targets {
+			p, ok := GetMixerPreamp(k.Bus, k.ID)
+			if ok && p.fromMixer("phantom") && p.fromMixer("pad") && p.fromMixer("gain") {
+				complete++
+			}
+		}
+		pullMu.Lock()
+		pullCurrent = complete
+		pullMu.Unlock()
+		if complete == len(targets) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	res := &pullResult{Method: "passive"}
+	channels := GetState()
+	for _, k := range targets {
+		p, ok := GetMixerPreamp(k.Bus, k.ID)
+		if !ok {
+			res.Missing = append(res.Missing, k)
+			continue
+		}
+		received := 0
+		for _, param := range []string{"phantom", "pad", "gain"} {
+			if p.fromMixer(param) {
+				received++
+			}
+		}
+		if received == 0 {
+			res.Missing = append(res.Missing, k)
+		}
+		if (p.Phantom != nil && !p.fromMixer("phantom")) || (p.Pad != nil && !p.fromMixer("pad")) ||
+			(p.Gain != nil && !p.fromMixer("gain")) {
+			res.SentOnly = append(res.SentOnly, k)
+		}
+		row := pulledPreamp{preampKey: k, mixerPreamp: p}
+		for _, ch := range channels {
+			if ch.PreampBus == k.Bus && (ch.PreampId == k.ID || ch.PreampIdR == k.ID) {
+				row.Channels = append(row.Channels, ch.ID)
+			}
+		}
+		if _, locked := lockedChannelFor(channels, k.Bus, k.ID); locked {
+			res.Locked = append(res.Locked, k)
+		} else if len(row.Channels) > 0 && received > 0 {
+			if p.fromMixer("phantom") {
+				UpdatePhantom(k.Bus, k.ID, *p.Phantom)
+			}
+			if p.fromMixer("pad") {
+				UpdatePad(k.Bus, k.ID, *p.Pad)
+			}
+			if p.fromMixer("gain") {
+				UpdateGain(k.Bus, k.ID, math.Round(*p.Gain))
+			}
+			res.Pulled++
+		}
+		if reportAll {
+			res.Preamps = append(res.Preamps, row)
+		}
+	}
+	if len(res.Missing) > 0 {
+		res.Note = pullMissingNote
+	}
+	pullMu.Lock()
+	pullLastResult = res
+	pullMu.Unlock()
+}
+
+func handleGetPullStatus(c *gin.Context) {
+	pullMu.Lock()
+	defer pullMu.Unlock()
+	out := gin.H{"status": pullStatus, "current": pullCurrent, "total": pullTotal}
+	if pullLastResult != nil {
+		out["last_result"] = pullLastResult
+	}
+	c.JSON(http.StatusOK, out)
+}
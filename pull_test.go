@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPullTakesConsoleChanges(t *testing.T) {
+	v, m := startTestSim(t)
+	useTempDataDir(t)
+	if err := SetStateAndCurrentShow([]ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 2, Gain: 10},
+		{ID: 2, PreampBus: "local", PreampId: 3, Gain: 10},
+	}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := mixer.Connect(v.Addr()); err != nil { // the pull's session; connecting clears the table
+		t.Fatal(err)
+	}
+	if err := m.Connect(v.Addr()); err != nil { // reads what the desk sends into the table
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return len(v.clients) == 2
+	})
+	// Someone changes local 2 on the console; local 3's gain is only known from our own send.
+	for _, b := range [][]byte{buildPhantom(2, true), buildPad(2, false), buildGain(2, 33)} {
+		f, _ := parseFrame(b)
+		v.apply(f, b, nil)
+	}
+	recordMixerFrame(preampFrame{Bus: "local", Preamp: 3, Kind: "gain", GainDB: 50}, "sent")
+	waitFor(t, func() bool {
+		p, _ := GetMixerPreamp("local", 2)
+		return p.fromMixer("gain")
+	})
+
+	runPullInBackground(v.Addr(), referencedPreamps(GetState()), false, 50*time.Millisecond)
+	pullMu.Lock()
+	res := pullLastResult
+	pullMu.Unlock()
+	if res.Pulled != 1 || len(res.SentOnly) != 1 || len(res.Missing) != 1 || res.Note == "" {
+		t.Fatalf("result = %+v", res)
+	}
+	channels := GetState()
+	if ch := channels[0]; !ch.Phantom || ch.Gain != 33 {
+		t.Errorf("channel 1 = %+v, want the console's phantom on, 33 dB", ch)
+	}
+	if ch := channels[1]; ch.Gain != 10 {
+		t.Errorf("channel 2 gain = %v, our own send was taken", ch.Gain)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+// Gain ramps: instead of jumping, step a preamp through the 1 dB raw values (0x80–0xBC) towards the target.
+// Any other command submitted for the same preamp cancels a ramp in progress (see mixerScheduler.Submit).
+
+const maxRampDuration = 30 * time.Second
+
+var errRampCancelled = errors.New("gain ramp cancelled by a newer command for the preamp")
+
+type gainRamp struct {
+	key  preampKey
+	stop chan struct{}
+	once sync.Once
+}
+
+func (r *gainRamp) cancel() { r.once.Do(func() { close(r.stop) }) }
+
+var (
+	rampMu sync.Mutex
+	ramps  = map[preampKey]*gainRamp{}
+)
+
+// startRamp registers a new ramp for k, cancelling any running one.
+func startRamp(k preampKey) *gainRamp {
+	r := &gainRamp{key: k, stop: make(chan struct{})}
+	rampMu.Lock()
+	if old := ramps[k]; old != nil {
+		old.cancel()
+	}
+	ramps[k] = r
+	rampMu.Unlock()
+	return r
+}
+
+func endRamp(r *gainRamp) {
+	rampMu.Lock()
+	if ramps[r.key] == r {
+		delete(ramps, r.key)
+	}
+	rampMu.Unlock()
+}
+
+// cancelRamp stops the ramp running on k unless it is except.
+func cancelRamp(k preampKey, except *gainRamp) {
+	rampMu.Lock()
+	defer rampMu.Unlock()
+	if r := ramps[k]; r != nil && r != except {
+		r.cancel()
+		delete(ramps, k)
+	}
+}
+
+// currentGain is where a ramp starts: the last known mixer value, else fallback (channel state).
+func currentGain(bus string, preamp int, fallback float64) float64 {
+	if p, ok := GetMixerPreamp(bus, preamp); ok && p.Gain != nil {
+		return *p.Gain
+	}
+	return fallback
+}
+
+// stateGain returns the gain in state of the first channel using the preamp, or def.
+func stateGain(bus string, preamp int, def float64) float64 {
+	for _, ch := range GetState() {
+		if ch.PreampBus == bus && (ch.PreampId == preamp || ch.PreampIdR == preamp) {
+			return ch.Gain
+		}
+	}
+	return def
+}
+
+// rampSteps is the number of 1 dB steps a ramp from → to sends.
+func rampSteps(from, to float64) int {
+	return int(math.Abs(math.Round(to) - math.Round(from)))
+}
+
+// rampGain steps cmd's preamp from `from` to `to` over dur through the scheduler, 1 dB per step; cmd gives
+// the address, preamp, priority and origin, and its OnSent runs after the final step. A ramp of one step or
+// less is a single send. Returns errRampCancelled if another command for the preamp came in; the mixer is
+// then left at the last step sent.
+func rampGain(cmd mixerCmd, from, to float64, dur time.Duration) error {
+	bus, preamp, onSent := cmd.Bus, cmd.Preamp, cmd.OnSent
+	cmd.Param = "gain"
+	start := math.Round(from)
+	n := rampSteps(from, to)
+	if n <= 1 || dur <= 0 {
+		cmd.Packet = buildGainBus(bus, preamp, to)
+		return scheduler.Submit(cmd)
+	}
+	if dur > maxRampDuration {
+		dur = maxRampDuration
+	}
+	dir := 1.0
+	if to < start {
+		dir = -1
+	}
+	r := startRamp(preampKey{bus, preamp})
+	defer endRamp(r)
+	log.Printf("sqapi: gain ramp %s preamp %d %.0f → %.0f dB over %v", bus, preamp, start, to, dur)
+	interval := dur / time.Duration(n)
+	for i := 1; i <= n; i++ {
+		if i > 1 {
+			select {
+			case <-r.stop:
+				return errRampCancelled
+			case <-time.After(interval):
+			}
+		}
+		db := start + float64(i)*dir
+		step := cmd
+		step.ramp, step.OnSent = r, nil
+		if i == n {
+			db = to
+			step.OnSent = onSent
+		}
+		step.Packet = buildGainBus(bus, preamp, db)
+		select {
+		case <-r.stop:
+			return errRampCancelled
+		default:
+		}
+		if err := scheduler.Submit(step); err != nil {
+			return fmt.Errorf("ramp step %.0f dB: %w", db, err)
+		}
+	}
+	return nil
+}
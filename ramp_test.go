@@ -0,0 +1,43 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+var startSchedulerOnce sync.Once
+
+func TestGainRampSteps(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	v.mu.Lock()
+	before := v.frames
+	v.mu.Unlock()
+	if err := rampGain(mixerCmd{Addr: v.Addr(), Bus: "local", Preamp: 5, Prio: prioInteractive}, 10, 15, 50*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		p, _ := v.Preamp("local", 5)
+		return p.Gain == 15
+	})
+	v.mu.Lock()
+	steps := v.frames - before
+	v.mu.Unlock()
+	if steps != 5 {
+		t.Errorf("ramp 10 → 15 dB sent %d frames, want 5", steps)
+	}
+
+	// A newer command for the preamp cancels the ramp.
+	errc := make(chan error, 1)
+	go func() {
+		errc <- rampGain(mixerCmd{Addr: v.Addr(), Bus: "local", Preamp: 5, Prio: prioInteractive}, 15, 60, 2*time.Second)
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := scheduler.Submit(mixerCmd{Addr: v.Addr(), Bus: "local", Preamp: 5, Param: "gain", Packet: buildGain(5, 20), Prio: prioInteractive}); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errc; err != errRampCancelled {
+		t.Errorf("ramp err = %v, want %v", err, errRampCancelled)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// Every packet to the mixer goes through one scheduler goroutine, so commands from concurrent requests and a
+// running sync never race on the wire.
+//   - panic commands go first, then interactive ones (preamp endpoints), then bulk ones (sync)
+//   - commands for the same preamp keep their submission order, whatever their priority
+//   - a queued interactive gain for a preamp is replaced by a newer one (slider drags)
+//   - any command for a preamp cancels a gain ramp running on it (ramp.go)
+//   - while disarmed (arm.go) only panic commands are sent; the rest fail with errDisarmed
+//   - a command whose ctx is cancelled (a sync job stopped by cancel or panic) fails instead of being sent
+
+const (
+	prioBulk = iota
+	prioInteractive
+	prioPanic // emergency commands (panic.go)
+)
+
+// mixerCmd is one packet to send. OnSent runs on the scheduler goroutine after a successful send, so state
+// updates happen in send order; a coalesced command's OnSent is replaced by the newer one.
+type mixerCmd struct {
+	Addr   string
+	Bus    string
+	Preamp int
+	Param  string // "phantom" | "pad" | "gain"
+	Packet []byte
+	Prio   int
+	OnSent func()
+	Origin *auditOrigin // who asked for it, for the audit log (audit.go); nil = internal
+
+	ctx  context.Context // nil = never cancelled
+	ramp *gainRamp       // set on the steps of a gain ramp; other commands for the preamp cancel the ramp
+	done []chan error    // every caller waiting on this (more than one after coalescing)
+}
+
+func (c *mixerCmd) samePreamp(o *mixerCmd) bool {
+	return c.Addr == o.Addr && c.Bus == o.Bus && c.Preamp == o.Preamp
+}
+
+type mixerScheduler struct {
+	mu    sync.Mutex
+	queue []*mixerCmd // submission order
+	wake  chan struct{}
+}
+
+var scheduler = newMixerScheduler()
+
+func newMixerScheduler() *mixerScheduler {
+	return &mixerScheduler{wake: make(chan struct{}, 1)}
+}
+
+// Start runs the send loop.
+func (s *mixerScheduler) Start() {
+	go s.run()
+}
+
+// Submit queues cmd and waits until it has been sent (or coalesced into a newer command that was sent).
+func (s *mixerScheduler) Submit(cmd mixerCmd) error {
+	cancelRamp(preampKey{cmd.Bus, cmd.Preamp}, cmd.ramp)
+	done := make(chan error, 1)
+	s.mu.Lock()
+	if !s.coalesceLocked(&cmd, done) {
+		cmd.done = []chan error{done}
+		s.queue = append(s.queue, &cmd)
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return <-done
+}
+
+// coalesceLocked folds an interactive gain into a queued interactive gain for the same preamp.
+func (s *mixerScheduler) coalesceLocked(cmd *mixerCmd, done chan error) bool {
+	if cmd.Param != "gain" || cmd.Prio != prioInteractive {
+		return false
+	}
+	for i := len(s.queue) - 1; i >= 0; i-- {
+		q := s.queue[i]
+		if !q.samePreamp(cmd) {
+			continue
+		}
+		if q.Param != "gain" || q.Prio != prioInteractive {
+			return false // something else for this preamp is in between: keep order
+		}
+		q.Packet = cmd.Packet
+		q.OnSent = cmd.OnSent
+		q.done = append(q.done, done)
+		return true
+	}
+	return false
+}
+
+// DropBulk fails every queued bulk command with err, e.g. when a panic pre-empts a sync.
+func (s *mixerScheduler) DropBulk(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.queue[:0]
+	for _, q := range s.queue {
+		if q.Prio != prioBulk {
+			kept = append(kept, q)
+			continue
+		}
+		for _, d := range q.done {
+			d <- err
+		}
+	}
+	s.queue = kept
+}
+
+// nextLocked removes and returns the next command: highest priority first, FIFO within a priority, but an
+// older command for the same preamp always goes before it.
+func (s *mixerScheduler) nextLocked() *mixerCmd {
+	if len(s.queue) == 0 {
+		return nil
+	}
+	best := 0
+	for i, q := range s.queue {
+		if q.Prio > s.queue[best].Prio {
+			best = i
+		}
+	}
+	for i, q := range s.queue[:best] {
+		if q.samePreamp(s.queue[best]) {
+			best = i
+			break
+		}
+	}
+	cmd := s.queue[best]
+	s.queue = append(s.queue[:best], s.queue[best+1:]...)
+	return cmd
+}
+
+func (s *mixerScheduler) run() {
+	for {
+		s.mu.Lock()
+		cmd := s.nextLocked()
+		s.mu.Unlock()
+		if cmd == nil {
+			<-s.wake
+			continue
+		}
+		old := mixerValue(cmd.Bus, cmd.Preamp, cmd.Param)
+		var err error
+		if cmd.Prio != prioPanic && !GetArmed() {
+			err = errDisarmed
+		} else if cmd.ctx != nil && cmd.ctx.Err() != nil {
+			err = context.Cause(cmd.ctx)
+		} else {
+			err = sendToSQ(cmd.Addr, cmd.Packet)
+		}
+		if err == nil && cmd.OnSent != nil {
+			cmd.OnSent()
+		}
+		if cmd.ramp == nil || cmd.OnSent != nil || err != nil { // a ramp is logged once, at its last step
+			auditMixerCmd(cmd, old, err)
+		}
+		for _, d := range cmd.done {
+			d <- err
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestSchedulerOrder(t *testing.T) {
+	s := newMixerScheduler()
+	s.queue = []*mixerCmd{
+		{Bus: "local", Preamp: 1, Param: "phantom", Prio: prioBulk},
+		{Bus: "local", Preamp: 2, Param: "phantom", Prio: prioBulk},
+		{Bus: "local", Preamp: 3, Param: "gain", Prio: prioInteractive},
+		{Bus: "local", Preamp: 2, Param: "gain", Prio: prioInteractive},
+	}
+	// Interactive first; the interactive gain for preamp 2 waits for the older bulk phantom on preamp 2.
+	want := []int{3, 2, 2, 1}
+	for i, w := range want {
+		cmd := s.nextLocked()
+		if cmd == nil || cmd.Preamp != w {
+			t.Fatalf("pick %d = %+v, want preamp %d", i, cmd, w)
+		}
+	}
+	if s.nextLocked() != nil {
+		t.Error("queue not empty")
+	}
+}
+
+func TestSchedulerCoalesceGain(t *testing.T) {
+	s := newMixerScheduler()
+	first := &mixerCmd{Bus: "slink", Preamp: 4, Param: "gain", Packet: buildGainSLink(4, 10), Prio: prioInteractive, done: []chan error{make(chan error, 1)}}
+	s.queue = []*mixerCmd{first}
+	newer := mixerCmd{Bus: "slink", Preamp: 4, Param: "gain", Packet: buildGainSLink(4, 30), Prio: prioInteractive}
+	if !s.coalesceLocked(&newer, make(chan error, 1)) {
+		t.Fatal("gain not coalesced")
+	}
+	if len(s.queue) != 1 || len(first.done) != 2 {
+		t.Fatalf("queue = %d, waiters = %d", len(s.queue), len(first.done))
+	}
+	if f, _ := parseFrame(first.Packet); f.GainDB != 30 {
+		t.Errorf("queued gain = %v, want 30", f.GainDB)
+	}
+	// A phantom in between keeps order: no coalescing across it.
+	s.queue = append(s.queue, &mixerCmd{Bus: "slink", Preamp: 4, Param: "phantom", Prio: prioInteractive})
+	later := mixerCmd{Bus: "slink", Preamp: 4, Param: "gain", Packet: buildGainSLink(4, 40), Prio: prioInteractive}
+	if s.coalesceLocked(&later, make(chan error, 1)) {
+		t.Error("gain coalesced across a phantom command")
+	}
+}
@@ -1,33 +1,30 @@
 package main
 
 import (
-	"fmt"
 	"log"
-	"net"
 	"time"
 )
 
 // LogTXPreamp writes one human-readable line per command sent to the mixer.
 func LogTXPreamp(bus string, preampId int, kind, value string) {
-	busLabel := "local"
-	if bus == "slink" {
-		busLabel = "S-Link"
-	}
-	log.Printf("sqapi: TX %s preamp %d %s %s", busLabel, preampId, kind, value)
+	log.Printf("sqapi: TX %s preamp %d %s %s", busLabel(bus), preampId, kind, value)
+}
+
+// LogRXPreamp writes one line per preamp frame received from the mixer.
+func LogRXPreamp(f preampFrame) {
+	log.Printf("sqapi: RX %s", f)
 }
 
 const sqTimeout = 3 * time.Second
 
+// sendToSQ writes one packet to the mixer over the shared session (see mixer.go) and records the sent value
+// in the mixer state table.
 func sendToSQ(addr string, payload []byte) error {
-	conn, err := net.DialTimeout("tcp", addr, sqTimeout)
-	if err != nil {
-		return fmt.Errorf("dial %s: %w", addr, err)
+	if err := mixer.Send(addr, payload); err != nil {
+		return err
 	}
-	defer conn.Close()
-	_ = conn.SetDeadline(time.Now().Add(sqTimeout))
-	_, err = conn.Write(payload)
-	if err != nil {
-		return fmt.Errorf("write: %w", err)
+	if f, err := parseFrame(payload); err == nil {
+		recordMixerFrame(f, "sent")
 	}
 	return nil
 }
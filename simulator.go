@@ -0,0 +1,315 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Virtual SQ for demo mode and testing: `sqapi simulate` listens on TCP 51326, accepts the F7 0C 0C frames
+// from protocol.go and keeps per-preamp phantom/pad/gain. Frames from one client are echoed to the other
+// clients, like the desk does for a second surface; changes made through the sim API are sent to all clients.
+
+type simPreamp struct {
+	Phantom bool    `json:"phantom"`
+	Pad     bool    `json:"pad"`
+	Gain    float64 `json:"gain"`
+}
+
+// simFaults are injected failures, settable over the sim API.
+type simFaults struct {
+	LatencyMS int     `json:"latency_ms"` // delay before each inbound frame is applied
+	DropRate  float64 `json:"drop_rate"`  // 0..1 chance to drop the connection after each frame
+	Refuse    bool    `json:"refuse"`     // stop listening: new connections are refused
+}
+
+type virtualSQ struct {
+	mu      sync.Mutex
+	addr    string
+	ln      net.Listener
+	preamps map[preampKey]*simPreamp
+	clients map[net.Conn]bool
+	faults  simFaults
+	frames  int
+}
+
+func newVirtualSQ() *virtualSQ {
+	v := &virtualSQ{preamps: map[preampKey]*simPreamp{}, clients: map[net.Conn]bool{}}
+	for _, k := range allPreamps() {
+		v.preamps[k] = &simPreamp{}
+	}
+	return v
+}
+
+// Listen starts accepting mixer connections on addr (e.g. "127.0.0.1:51326" or ":0").
+func (v *virtualSQ) Listen(addr string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.listenLocked(addr)
+}
+
+func (v *virtualSQ) listenLocked(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	v.ln = ln
+	v.addr = ln.Addr().String()
+	go v.acceptLoop(ln)
+	return nil
+}
+
+// Addr is the address the sim listens on (resolved port when started on :0).
+func (v *virtualSQ) Addr() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.addr
+}
+
+// Close stops listening and drops all clients.
+func (v *virtualSQ) Close() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.ln != nil {
+		_ = v.ln.Close()
+		v.ln = nil
+	}
+	for conn := range v.clients {
+		_ = conn.Close()
+	}
+}
+
+func (v *virtualSQ) acceptLoop(ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		v.mu.Lock()
+		v.clients[conn] = true
+		v.mu.Unlock()
+		log.Printf("sqapi sim: client %s connected", conn.RemoteAddr())
+		go v.serve(conn)
+	}
+}
+
+func (v *virtualSQ) serve(conn net.Conn) {
+	defer func() {
+		v.mu.Lock()
+		delete(v.clients, conn)
+		v.mu.Unlock()
+		_ = conn.Close()
+		log.Printf("sqapi sim: client %s disconnected", conn.RemoteAddr())
+	}()
+	buf := make([]byte, 1024)
+	var pending []byte
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return
+		}
+		var chunks [][]byte
+		chunks, pending = splitFrames(append(pending, buf[:n]...))
+		for _, chunk := range chunks {
+			f, err := parseFrame(chunk)
+			if err != nil {
+				log.Printf("sqapi sim: ignored % X", chunk)
+				continue
+			}
+			v.mu.Lock()
+			faults := v.faults
+			v.mu.Unlock()
+			if faults.LatencyMS > 0 {
+				time.Sleep(time.Duration(faults.LatencyMS) * time.Millisecond)
+			}
+			v.apply(f, chunk, conn)
+			if faults.DropRate > 0 && rand.Float64() < faults.DropRate {
+				log.Printf("sqapi sim: dropping client %s", conn.RemoteAddr())
+				return
+			}
+		}
+		pending = append([]byte(nil), pending...)
+	}
+}
+
+// apply stores one frame and echoes it to every client except from (nil = all clients).
+func (v *virtualSQ) apply(f preampFrame, frame []byte, from net.Conn) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	p := v.preamps[preampKey{f.Bus, f.Preamp}]
+	if p == nil {
+		return
+	}
+	switch f.Kind {
+	case "phantom":
+		p.Phantom = f.On
+	case "pad":
+		p.Pad = f.On
+	case "gain":
+		p.Gain = f.GainDB
+	}
+	v.frames++
+	for conn := range v.clients {
+		if conn == from {
+			continue
+		}
+		_ = conn.SetWriteDeadline(time.Now().Add(sqTimeout))
+		_, _ = conn.Write(frame)
+	}
+}
+
+// Preamp returns the sim's current values for one preamp.
+func (v *virtualSQ) Preamp(bus string, id int) (simPreamp, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	p := v.preamps[preampKey{bus, id}]
+	if p == nil {
+		return simPreamp{}, false
+	}
+	return *p, true
+}
+
+// SetFaults replaces the injected faults; toggling Refuse closes or reopens the listener.
+func (v *virtualSQ) SetFaults(f simFaults) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if f.Refuse && v.ln != nil {
+		_ = v.ln.Close()
+		v.ln = nil
+	}
+	if !f.Refuse && v.ln == nil && v.addr != "" {
+		if err := v.listenLocked(v.addr); err != nil {
+			return err
+		}
+	}
+	v.faults = f
+	return nil
+}
+
+// simPreampRow is one row of GET /api/sim/preamps.
+type simPreampRow struct {
+	preampKey
+	simPreamp
+}
+
+func (v *virtualSQ) handleGetPreamps(c *gin.Context) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	rows := make([]simPreampRow, 0, len(v.preamps))
+	for _, k := range allPreamps() {
+		rows = append(rows, simPreampRow{k, *v.preamps[k]})
+	}
+	c.JSON(http.StatusOK, gin.H{"preamps": rows, "clients": len(v.clients), "frames": v.frames})
+}
+
+// handlePostPreamp simulates a change on the console surface: it is applied and sent to all clients.
+// Body: {"phantom": true, "pad": false, "gain": 30}; omitted fields are left alone.
+func (v *virtualSQ) handlePostPreamp(c *gin.Context) {
+	bus := c.Param("bus")
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid preamp id"})
+		return
+	}
+	if _, ok := v.Preamp(bus, id); !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("no %s preamp %d", bus, id)})
+		return
+	}
+	var body struct {
+		Phantom *bool    `json:"phantom"`
+		Pad     *bool    `json:"pad"`
+		Gain    *float64 `json:"gain"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var frames [][]byte
+	if bus == "slink" {
+		if body.Phantom != nil {
+			frames = append(frames, buildPhantomSLink(id, *body.Phantom))
+		}
+		if body.Pad != nil {
+			frames = append(frames, buildPadSLink(id, *body.Pad))
+		}
+		if body.Gain != nil {
+			frames = append(frames, buildGainSLink(id, math.Round(*body.Gain)))
+		}
+	} else {
+		if body.Phantom != nil {
+			frames = append(frames, buildPhantom(id, *body.Phantom))
+		}
+		if body.Pad != nil {
+			frames = append(frames, buildPad(id, *body.Pad))
+		}
+		if body.Gain != nil {
+			frames = append(frames, buildGain(id, math.Round(*body.Gain)))
+		}
+	}
+	for _, b := range frames {
+		f, _ := parseFrame(b)
+		v.apply(f, b, nil)
+	}
+	p, _ := v.Preamp(bus, id)
+	c.JSON(http.StatusOK, simPreampRow{preampKey{bus, id}, p})
+}
+
+func (v *virtualSQ) handleGetFaults(c *gin.Context) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	c.JSON(http.StatusOK, v.faults)
+}
+
+func (v *virtualSQ) handlePostFaults(c *gin.Context) {
+	var f simFaults
+	if err := c.ShouldBindJSON(&f); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if f.DropRate < 0 || f.DropRate > 1 || f.LatencyMS < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "drop_rate must be 0..1, latency_ms >= 0"})
+		return
+	}
+	if err := v.SetFaults(f); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, f)
+}
+
+// runSimulate is the `sqapi simulate` subcommand. Point sq_ip at 127.0.0.1 to use it.
+func runSimulate(args []string) {
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:"+sqPort, "mixer TCP address to listen on")
+	httpAddr := fs.String("http", "127.0.0.1:8081", "sim API address (state and faults)")
+	latency := fs.Int("latency", 0, "delay in ms before each frame is applied")
+	drop := fs.Float64("drop", 0, "chance (0..1) to drop the connection after each frame")
+	_ = fs.Parse(args)
+
+	v := newVirtualSQ()
+	if err := v.Listen(*listen); err != nil {
+		log.Fatalf("sqapi sim: listen: %v", err)
+	}
+	v.faults = simFaults{LatencyMS: *latency, DropRate: *drop}
+	log.Printf("sqapi sim: mixer on %s, API on http://%s/api/sim/preamps", v.Addr(), *httpAddr)
+
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.GET("/api/sim/preamps", v.handleGetPreamps)
+	r.POST("/api/sim/preamps/:bus/:id", v.handlePostPreamp)
+	r.GET("/api/sim/faults", v.handleGetFaults)
+	r.POST("/api/sim/faults", v.handlePostFaults)
+	if err := http.ListenAndServe(*httpAddr, r); err != nil {
+		log.Fatalf("sqapi sim: server: %v", err)
+	}
+}
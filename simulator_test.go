@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startTestSim(t *testing.T) (*virtualSQ, *mixerSession) {
+	t.Helper()
+	v := newVirtualSQ()
+	if err := v.Listen("127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	m := newMixerSession()
+	m.Start()
+	t.Cleanup(func() {
+		m.Close()
+		v.Close()
+	})
+	return v, m
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// watchSim connects a second client to v and returns a function listing the frames v applied since, in
+// order, as "phantom on" / "gain 40 dB" (the desk echoes every change to the other surfaces).
+func watchSim(t *testing.T, v *virtualSQ) func() []string {
+	t.Helper()
+	v.mu.Lock()
+	clients := len(v.clients)
+	v.mu.Unlock()
+	conn, err := net.Dial("tcp", v.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	waitFor(t, func() bool {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return len(v.clients) > clients
+	})
+	var mu sync.Mutex
+	var frames []string
+	go func() {
+		buf := make([]byte, 1024)
+		var pending []byte
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			var chunks [][]byte
+			chunks, pending = splitFrames(append(pending, buf[:n]...))
+			pending = append([]byte(nil), pending...)
+			for _, chunk := range chunks {
+				if f, err := parseFrame(chunk); err == nil {
+					mu.Lock()
+					frames = append(frames, fmt.Sprintf("%s %d %s %s", f.Bus, f.Preamp, f.Kind, f.value()))
+					mu.Unlock()
+				}
+			}
+		}
+	}()
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), frames...)
+	}
+}
+
+func TestSimulatorAppliesFrames(t *testing.T) {
+	v, m := startTestSim(t)
+	for _, pkt := range [][]byte{buildPhantom(3, true), buildPadSLink(40, true), buildGain(17, 42)} {
+		if err := m.Send(v.Addr(), pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor(t, func() bool {
+		p, _ := v.Preamp("local", 17)
+		return p.Gain == 42
+	})
+	if p, _ := v.Preamp("local", 3); !p.Phantom {
+		t.Errorf("local 3 phantom = %v, want on", p.Phantom)
+	}
+	if p, _ := v.Preamp("slink", 40); !p.Pad {
+		t.Errorf("slink 40 pad = %v, want on", p.Pad)
+	}
+}
+
+func TestSimulatorRefuse(t *testing.T) {
+	v, m := startTestSim(t)
+	addr := v.Addr()
+	if err := v.SetFaults(simFaults{Refuse: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(addr, buildPhantom(1, true)); err == nil {
+		t.Error("send while refusing: want error")
+	}
+	if st := m.Status(); st.State != mixerDisconnected {
+		t.Errorf("state = %s, want %s", st.State, mixerDisconnected)
+	}
+	if err := v.SetFaults(simFaults{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(addr, buildPhantom(1, true)); err != nil {
+		t.Errorf("send after refuse cleared: %v", err)
+	}
+}
+
+func TestSimulatorConsoleChangeReachesMixerTable(t *testing.T) {
+	v, m := startTestSim(t)
+	if err := m.Connect(v.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		return len(v.clients) == 1
+	})
+	b := buildGainSLink(12, 33)
+	f, _ := parseFrame(b)
+	v.apply(f, b, nil)
+	waitFor(t, func() bool {
+		p, ok := GetMixerPreamp("slink", 12)
+		return ok && p.Gain != nil && *p.Gain == 33
+	})
+}
@@ -2,28 +2,40 @@ package main
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"time"
 )
 
 type ChannelState struct {
-	ID        int     `json:"id"`
-	Name      string  `json:"name"`
-	PreampBus string  `json:"preampBus"`
-	PreampId  int     `json:"preampId"`
-	PreampIdR int     `json:"preampIdR,omitempty"` // optional right preamp for stereo; 0 = mono
-	Phantom   bool    `json:"phantom"`
-	Pad       bool    `json:"pad"`
-	Gain      float64 `json:"gain"`
+	ID        int      `json:"id"`
+	Name      string   `json:"name"`
+	PreampBus string   `json:"preampBus"`
+	PreampId  int      `json:"preampId"`
+	PreampIdR int      `json:"preampIdR,omitempty"` // optional right preamp for stereo; 0 = mono
+	Phantom   bool     `json:"phantom"`
+	Pad       bool     `json:"pad"`
+	Gain      float64  `json:"gain"`
+	Tags      []string `json:"tags,omitempty"` // free-form labels, e.g. "stagebox" for selective sync
+
+	// Safety limits, enforced by the server on every send (limits.go).
+	MaxGain          *float64 `json:"maxGain,omitempty"`
+	PhantomForbidden bool     `json:"phantomForbidden,omitempty"`
+	PadRequired      bool     `json:"padRequired,omitempty"`
+
+	// Locked channels are not changed by preamp endpoints, POST /api/state or sync (lock.go).
+	Locked bool `json:"locked,omitempty"`
 }
 
 // stateFile is the persisted format (state.json). Backward compatible: LoadState also accepts legacy array-only JSON.
 type stateFile struct {
 	Channels    []ChannelState `json:"channels"`
 	CurrentShow string         `json:"current_show"`
+	Revision    uint64         `json:"revision"` // see GetStateRevision
 }
 
 var (
@@ -40,56 +52,51 @@ func LoadState() error {
 	if err := ensureDataDir(); err != nil {
 		return err
 	}
-	b, err := os.ReadFile(statePath())
-	if err != nil {
-		if os.IsNotExist(err) {
-			stateChans = nil
-			stateCurrentShow = ""
-			return nil
-		}
+	b, err := readFileRecover(statePath())
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
 	var file stateFile
-	if err := json.Unmarshal(b, &file); err != nil {
-		var list []ChannelState
-		if err2 := json.Unmarshal(b, &list); err2 != nil {
-			return err
+	if err == nil {
+		if err := json.Unmarshal(b, &file); err != nil {
+			var list []ChannelState
+			if err2 := json.Unmarshal(b, &list); err2 != nil {
+				return err
+			}
+			file = stateFile{Channels: list} // legacy state.json: a bare channel list
 		}
-		stateChans = list
-		stateCurrentShow = ""
-		return nil
 	}
+	changed := !reflect.DeepEqual(cloneChannels(stateChans), cloneChannels(file.Channels)) || file.CurrentShow != stateCurrentShow
 	stateChans = file.Channels
 	if stateChans == nil {
 		stateChans = []ChannelState{}
 	}
 	stateCurrentShow = file.CurrentShow
+	// Revisions never go back in a running server, even when switching to an older data dir (or one without a
+	// state.json): a load that changes the state gets a new revision, so clients holding the old one get 409.
+	if file.Revision > stateRev {
+		stateRev = file.Revision
+	} else if changed {
+		stateRev++
+	}
+	persistMu.Lock()
+	persistedGen = stateRev
+	persistMu.Unlock()
+	loadHistoryLocked() // the dir's own history, or none: never the previous dir's
 	return nil
 }
 
 const saveStateRetries = 3
 const saveStateBackoff = 50 * time.Millisecond
 
+// saveStateLocked writes state.json (and history.json) synchronously. Caller holds stateMu.
 func saveStateLocked() error {
-	if err := ensureDataDir(); err != nil {
-		return err
-	}
-	file := stateFile{Channels: stateChans, CurrentShow: stateCurrentShow}
-	b, err := json.MarshalIndent(file, "", "  ")
+	stateRev++
+	gen, state, hist, err := stateSnapshotLocked()
 	if err != nil {
 		return err
 	}
-	path := statePath()
-	for attempt := 0; attempt < saveStateRetries; attempt++ {
-		if err := os.WriteFile(path, b, 0644); err == nil {
-			return nil
-		} else if attempt == saveStateRetries-1 {
-			log.Printf("sqapi: save state failed after %d attempts: %v", saveStateRetries, err)
-			return err
-		}
-		time.Sleep(saveStateBackoff)
-	}
-	return nil
+	return writeStateSnapshot(gen, state, hist)
 }
 
 func GetState() []ChannelState {
@@ -106,28 +113,83 @@ func GetState() []ChannelState {
 func SetState(channels []ChannelState) error {
 	stateMu.Lock()
 	defer stateMu.Unlock()
+	before := cloneChannels(stateChans)
 	stateChans = channels
+	recordHistoryLocked("save state", "", before)
 	return saveStateLocked()
 }
 
+// errRevisionConflict: the state changed since the revision the client based its edit on.
+var errRevisionConflict = errors.New("state was changed by someone else; reload and retry")
+
+// GetStateRevision returns the state revision. It increases with every change (channel list, preamp values,
+// current show) and is the ETag of /api/state.
+func GetStateRevision() uint64 {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	return stateRev
+}
+
+// GetStateSnapshot returns the channels, current show and revision as of one moment.
+func GetStateSnapshot() ([]ChannelState, string, uint64) {
+	stateMu.RLock()
+	defer stateMu.RUnlock()
+	return cloneChannels(stateChans), stateCurrentShow, stateRev
+}
+
 // SetStateAndCurrentShow saves channels and (optionally) current show in one write.
-// If show is nil, keeps existing current show.
-func SetStateAndCurrentShow(channels []ChannelState, show *string) error {
+// If show is nil, keeps existing current show. If ifRev is set and is not the current revision, nothing is
+// changed and errRevisionConflict is returned.
+func SetStateAndCurrentShow(channels []ChannelState, show *string, ifRev *uint64) error {
 	stateMu.Lock()
 	defer stateMu.Unlock()
+	if ifRev != nil && *ifRev != stateRev {
+		return errRevisionConflict
+	}
+	before := cloneChannels(stateChans)
 	stateChans = channels
+	action := "save state"
 	if show != nil {
 		stateCurrentShow = *show
+		if *show != "" {
+			action = "load show " + *show
+		}
 	}
+	recordHistoryLocked(action, "", before)
 	return saveStateLocked()
 }
 
+// EditState applies fn to a copy of the channel list, validates the result with normalizeAndValidateChannels
+// and saves it, all under one lock. Returns the channel lists before and after; after is nil if fn or the
+// validation failed and nothing changed. If ifRev is set and is not the current revision, nothing is changed
+// and errRevisionConflict is returned.
+func EditState(action string, ifRev *uint64, fn func([]ChannelState) ([]ChannelState, error)) ([]ChannelState, []ChannelState, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if ifRev != nil && *ifRev != stateRev {
+		return nil, nil, errRevisionConflict
+	}
+	before := cloneChannels(stateChans)
+	next, err := fn(cloneChannels(stateChans))
+	if err != nil {
+		return before, nil, err
+	}
+	if next, err = normalizeAndValidateChannels(next, before); err != nil {
+		return before, nil, err
+	}
+	stateChans = next
+	recordHistoryLocked(action, "", before)
+	return before, cloneChannels(stateChans), saveStateLocked()
+}
+
 // ResetState clears state.json: empty channel list and current show. Used by config "Reset state".
 func ResetState() error {
 	stateMu.Lock()
 	defer stateMu.Unlock()
+	before := cloneChannels(stateChans)
 	stateChans = []ChannelState{}
 	stateCurrentShow = ""
+	recordHistoryLocked("reset state", "", before)
 	return saveStateLocked()
 }
 
@@ -144,9 +206,23 @@ func SetCurrentShow(show string) error {
 	return saveStateLocked()
 }
 
+// SetChannelLocked sets the lock flag of channel id; false if there is no such channel.
+func SetChannelLocked(id int, locked bool) (bool, error) {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	for i := range stateChans {
+		if stateChans[i].ID == id {
+			stateChans[i].Locked = locked
+			return true, saveStateLocked()
+		}
+	}
+	return false, nil
+}
+
 func UpdatePhantom(bus string, preampId int, on bool) {
 	stateMu.Lock()
 	defer stateMu.Unlock()
+	before := cloneChannels(stateChans)
 	for i := range stateChans {
 		c := &stateChans[i]
 		if c.PreampBus != bus {
@@ -156,12 +232,33 @@ func UpdatePhantom(bus string, preampId int, on bool) {
 			c.Phantom = on
 		}
 	}
-	_ = saveStateLocked()
+	recordHistoryLocked(fmt.Sprintf("phantom %s %d %s", bus, preampId, boolToOnOff(on)), fmt.Sprintf("phantom/%s/%d", bus, preampId), before)
+	markStateDirtyLocked()
+}
+
+// UpdatePhantomMany sets phantom on every channel using one of the preamps, with a single save.
+func UpdatePhantomMany(preamps []preampKey, on bool) {
+	set := map[preampKey]bool{}
+	for _, k := range preamps {
+		set[k] = true
+	}
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	before := cloneChannels(stateChans)
+	for i := range stateChans {
+		c := &stateChans[i]
+		if set[preampKey{c.PreampBus, c.PreampId}] || (c.PreampIdR != 0 && set[preampKey{c.PreampBus, c.PreampIdR}]) {
+			c.Phantom = on
+		}
+	}
+	recordHistoryLocked(fmt.Sprintf("phantom %s on %d preamps", boolToOnOff(on), len(preamps)), "", before)
+	markStateDirtyLocked()
 }
 
 func UpdatePad(bus string, preampId int, on bool) {
 	stateMu.Lock()
 	defer stateMu.Unlock()
+	before := cloneChannels(stateChans)
 	for i := range stateChans {
 		c := &stateChans[i]
 		if c.PreampBus != bus {
@@ -171,12 +268,14 @@ func UpdatePad(bus string, preampId int, on bool) {
 			c.Pad = on
 		}
 	}
-	_ = saveStateLocked()
+	recordHistoryLocked(fmt.Sprintf("pad %s %d %s", bus, preampId, boolToOnOff(on)), fmt.Sprintf("pad/%s/%d", bus, preampId), before)
+	markStateDirtyLocked()
 }
 
 func UpdateGain(bus string, preampId int, db float64) {
 	stateMu.Lock()
 	defer stateMu.Unlock()
+	before := cloneChannels(stateChans)
 	for i := range stateChans {
 		c := &stateChans[i]
 		if c.PreampBus != bus {
@@ -186,5 +285,6 @@ func UpdateGain(bus string, preampId int, db float64) {
 			c.Gain = db
 		}
 	}
-	_ = saveStateLocked()
+	recordHistoryLocked(fmt.Sprintf("gain %s %d %.0f dB", bus, preampId, db), fmt.Sprintf("gain/%s/%d", bus, preampId), before)
+	markStateDirtyLocked()
 }
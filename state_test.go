@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useTempDataDir points the data dir at a fresh temp dir (with shows/) for the rest of the test.
+func useTempDataDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "shows"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	configMu.Lock()
+	old := dataDir
+	dataDir = dir
+	configMu.Unlock()
+	t.Cleanup(func() {
+		flushAudit() // queued entries go to dir, which is removed after this
+		configMu.Lock()
+		dataDir = old
+		configMu.Unlock()
+	})
+	return dir
+}
+
+// setTestConfig changes the in-memory config for the rest of the test.
+func setTestConfig(t *testing.T, fn func(*config)) {
+	t.Helper()
+	configMu.Lock()
+	old := cfg
+	fn(&cfg)
+	configMu.Unlock()
+	t.Cleanup(func() {
+		configMu.Lock()
+		cfg = old
+		configMu.Unlock()
+	})
+}
+
+func TestStateRevision(t *testing.T) {
+	useTempDataDir(t)
+
+	if err := SetStateAndCurrentShow([]ChannelState{{ID: 1, PreampBus: "local", PreampId: 1}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	rev := GetStateRevision()
+	UpdateGain("local", 1, 20) // preamp endpoints bump the revision too
+	if GetStateRevision() <= rev {
+		t.Fatalf("revision %d not bumped from %d", GetStateRevision(), rev)
+	}
+	if err := SetStateAndCurrentShow(nil, nil, &rev); !errors.Is(err, errRevisionConflict) {
+		t.Fatalf("stale revision: %v", err)
+	}
+	if ch, _, _ := GetStateSnapshot(); len(ch) != 1 || ch[0].Gain != 20 {
+		t.Fatalf("state changed on conflict: %+v", ch)
+	}
+	cur := GetStateRevision()
+	if err := SetStateAndCurrentShow([]ChannelState{}, nil, &cur); err != nil {
+		t.Fatal(err)
+	}
+	if err := FlushState(); err != nil {
+		t.Fatal(err)
+	}
+	want := GetStateRevision()
+	if err := LoadState(); err != nil || GetStateRevision() != want {
+		t.Errorf("revision after reload = %d, want %d (%v)", GetStateRevision(), want, err)
+	}
+}
+
+func TestLoadStateNewRevision(t *testing.T) {
+	useTempDataDir(t)
+	if err := SetStateAndCurrentShow([]ChannelState{{ID: 1, PreampBus: "local", PreampId: 1}}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := FlushState(); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		"missing": "",
+		"legacy":  `[{"id": 2, "preampBus": "local", "preampId": 2}]`,
+		"older":   `{"channels": [{"id": 3, "preampBus": "slink", "preampId": 3}], "revision": 1}`,
+	} {
+		rev := GetStateRevision()
+		dir := useTempDataDir(t) // like switching data_dir in POST /api/config
+		if content != "" {
+			if err := os.WriteFile(filepath.Join(dir, "state.json"), []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := LoadState(); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if GetStateRevision() <= rev {
+			t.Errorf("%s: revision %d not bumped from %d", name, GetStateRevision(), rev)
+		}
+		if err := SetStateAndCurrentShow(nil, nil, &rev); !errors.Is(err, errRevisionConflict) {
+			t.Errorf("%s: save based on the old dir's revision: %v", name, err)
+		}
+	}
+}
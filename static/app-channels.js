@@ -309,19 +309,15 @@ function addChannel() {
       return;
     }
   }
-  channels.push({
-    id: nextId(),
-    name: '',
-    preampBus: bus,
-    preampId: id,
-    preampIdR: 0,
-    phantom: false,
-    pad: false,
-    gain: 0,
-  });
-  saveStateToServer().catch(() => {});
-  const container = document.getElementById('channels');
-  container.appendChild(renderChannel(channels[channels.length - 1]));
+  // The server assigns the channel ID.
+  api('/api/channels', {
+    method: 'POST',
+    body: JSON.stringify({ name: '', preampBus: bus, preampId: id, preampIdR: 0, phantom: false, pad: false, gain: 0 }),
+  }).then((ch) => {
+    channels.push(ch);
+    const container = document.getElementById('channels');
+    container.appendChild(renderChannel(ch));
+  }).catch((e) => toast(e.message, 'error'));
 }
 
 function setEditMode(on) {
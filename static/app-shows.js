@@ -124,8 +124,8 @@ async function loadShowFromServer(name) {
     if (!res.ok) throw new Error('Load failed');
     const data = await res.json();
     const list = Array.isArray(data.channels) ? data.channels : (Array.isArray(data.cubes) ? data.cubes : []);
-    const startId = nextId();
-    channels = list.map((c, i) => {
+    // No ids: the server assigns them (POST /api/state), so they never clash with existing channels.
+    channels = list.map((c) => {
       const bus = c.preampBus === 'slink' ? 'slink' : 'local';
       const rawId = c.preampId ?? c.channel ?? 1;
       const max = bus === 'slink' ? PREAMP_SLINK_MAX : PREAMP_LOCAL_MAX;
@@ -134,7 +134,6 @@ async function loadShowFromServer(name) {
       if (idR === id || idR < 1 || idR > max) idR = 0;
       if (bus === 'local' && idR && !isSameLocalFamily(id, idR)) idR = 0;
       return {
-        id: startId + i,
         name: c.name ?? '',
         preampBus: bus,
         preampId: id,
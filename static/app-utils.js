@@ -7,6 +7,9 @@ let editMode = false;
 /** Last known config from backend (sq_ip, data_dir). */
 let lastConfig = { sq_ip: '', data_dir: 'data' };
 
+/** Revision of the state channels came from (GET /api/state); sent with saves so stale ones get 409. */
+let stateRevision = null;
+
 async function loadStateFromServer() {
   try {
     const [stateData, configData] = await Promise.all([
@@ -15,11 +18,13 @@ async function loadStateFromServer() {
     ]);
     channels = Array.isArray(stateData.channels) ? stateData.channels : [];
     channels.forEach(normalizeChannelPreamp);
+    stateRevision = stateData.revision != null ? stateData.revision : null;
     lastConfig.sq_ip = (stateData.sq_ip != null ? String(stateData.sq_ip) : '').trim();
     lastConfig.data_dir = (configData.data_dir != null ? String(configData.data_dir) : 'data').trim() || 'data';
     linePreampIds = Array.isArray(stateData.line_preamp_ids) ? stateData.line_preamp_ids : [18, 19, 20, 21];
   } catch (_) {
     channels = [];
+    stateRevision = null;
   }
 }
 
@@ -33,17 +38,40 @@ function isLineChannel(channel) {
   return L && (!channel.preampIdR || R);
 }
 
+/** Saves run one after another, each based on the revision the previous one returned. */
+let saveQueue = Promise.resolve();
+
 function saveStateToServer(currentShow) {
   const payload = { channels };
   if (currentShow !== undefined && currentShow !== null) payload.current_show = currentShow;
-  return fetch(API_BASE + '/api/state', {
-    method: 'POST',
-    headers: { 'Content-Type': 'application/json' },
-    body: JSON.stringify(payload),
-  }).then((res) => {
-    if (!res.ok) return res.json().then((err) => { throw new Error(err.error || res.statusText); });
-    return res.json();
-  });
+  const save = () => {
+    if (stateRevision != null) payload.revision = stateRevision;
+    return fetch(API_BASE + '/api/state', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(payload),
+    }).then(async (res) => {
+      const data = await res.json().catch(() => ({}));
+      if (res.status === 409) {
+        // Changed elsewhere (or refused by a limit): show what the server has instead of our edit.
+        await loadStateFromServer();
+        render();
+        toast(data.error || 'State changed elsewhere; reloaded', 'error');
+      }
+      if (!res.ok) throw new Error(data.error || res.statusText);
+      if (data.revision != null) stateRevision = data.revision;
+      return data;
+    });
+  };
+  const run = saveQueue.then(save, save);
+  saveQueue = run.catch(() => {});
+  return run;
+}
+
+/** Adopts the revision a preamp endpoint returns: the change it made is already in channels. */
+function trackRevision(data) {
+  if (data && data.revision != null) stateRevision = data.revision;
+  return data;
 }
 
 function getStoredIP() {
@@ -54,11 +82,6 @@ function setStoredIP(ip) {
   lastConfig.sq_ip = (ip || '').trim();
 }
 
-function nextId() {
-  const ids = channels.map((c) => c.id).filter(Boolean);
-  return ids.length ? Math.max(...ids) + 1 : 1;
-}
-
 const PREAMP_LOCAL_MAX = 21; // 1–17 input/talkback, 18–21 stereo line (ST1 L/R, ST2 L/R)
 const PREAMP_SLINK_MAX = 40;
 
@@ -137,15 +160,15 @@ function toast(msg, type = 'success') {
 }
 
 function sendPhantom(bus, id, on) {
-  return api(`/preamp/${bus}/${id}/phantom?on=${on}`, { method: 'POST' });
+  return api(`/preamp/${bus}/${id}/phantom?on=${on}`, { method: 'POST' }).then(trackRevision);
 }
 
 function sendPad(bus, id, on) {
-  return api(`/preamp/${bus}/${id}/pad?on=${on}`, { method: 'POST' });
+  return api(`/preamp/${bus}/${id}/pad?on=${on}`, { method: 'POST' }).then(trackRevision);
 }
 
 function sendGain(bus, id, db) {
-  return api(`/preamp/${bus}/${id}/gain`, { method: 'POST', body: JSON.stringify({ db }) });
+  return api(`/preamp/${bus}/${id}/gain`, { method: 'POST', body: JSON.stringify({ db }) }).then(trackRevision);
 }
 
 function escapeAttr(s) {
@@ -21,6 +21,8 @@ document.getElementById('config-save').addEventListener('click', async () => {
   const dataDir = document.getElementById('config-data-dir').value.trim() || 'data';
   try {
     await saveConfigPayload({ sq_ip: sqip, data_dir: dataDir });
+    await loadStateFromServer(); // the data dir may have changed
+    render();
     toast('Config saved');
     closeConfigModal();
   } catch (e) {
@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 )
 
 const defaultDataDir = "data"
@@ -15,13 +16,28 @@ const defaultDataDir = "data"
 var (
 	dataDir  = defaultDataDir
 	configMu sync.RWMutex
+	cfg      config // last loaded or saved config.json
 )
 
 type config struct {
-	SQIP    string `json:"sq_ip"`
-	DataDir string `json:"data_dir"`
+	SQIP       string `json:"sq_ip"`
+	DataDir    string `json:"data_dir"`
+	SyncPaceMS *int   `json:"sync_pace_ms,omitempty"` // pause between preamps during sync; nil = 40 ms
+
+	PhantomSafety  *phantomSafety  `json:"phantom_safety,omitempty"`  // nil = defaultPhantomSafety (on)
+	UnusedDefaults *preampDefaults `json:"unused_defaults,omitempty"` // nil = phantom off, pad off, 0 dB
+	Armed          *bool           `json:"armed,omitempty"`           // nil = armed (arm.go)
+}
+
+// preampDefaults are the values unused preamps are reset to.
+type preampDefaults struct {
+	Phantom bool    `json:"phantom"`
+	Pad     bool    `json:"pad"`
+	Gain    float64 `json:"gain"`
 }
 
+const defaultSyncPace = 40 * time.Millisecond
+
 // configPath returns the fixed config file path (independent of dataDir).
 func configPath() string { return "config.json" }
 func showsDir() string   { return filepath.Join(GetDataDir(), "shows") }
@@ -37,7 +53,7 @@ func LoadConfig() (sqip string, dataDirOut string, err error) {
 	configMu.Lock()
 	defer configMu.Unlock()
 	cfgPath := configPath()
-	b, err := os.ReadFile(cfgPath)
+	b, err := readFileRecover(cfgPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Migrate from legacy data/config.json if present
@@ -60,6 +76,7 @@ func LoadConfig() (sqip string, dataDirOut string, err error) {
 	if err := json.Unmarshal(b, &c); err != nil {
 		return "", "", err
 	}
+	cfg = c
 	dataDir = strings.TrimSpace(c.DataDir)
 	if dataDir == "" {
 		dataDir = defaultDataDir
@@ -71,12 +88,13 @@ func writeConfigLocked(sqip, dir string) error {
 	if dir == "" {
 		dir = defaultDataDir
 	}
-	c := config{SQIP: strings.TrimSpace(sqip), DataDir: dir}
-	b, err := json.MarshalIndent(c, "", "  ")
+	cfg.SQIP = strings.TrimSpace(sqip)
+	cfg.DataDir = dir
+	b, err := json.MarshalIndent(cfg, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(configPath(), b, 0644)
+	return writeFileAtomic(configPath(), b, 0644, true)
 }
 
 func SaveConfig(sqip, dir string) error {
@@ -96,6 +114,58 @@ func SaveConfig(sqip, dir string) error {
 	return nil
 }
 
+// GetConfigSnapshot returns a copy of the in-memory config.
+func GetConfigSnapshot() config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return cfg
+}
+
+// UpdateConfig applies fn to the in-memory config and writes config.json.
+func UpdateConfig(fn func(*config)) error {
+	configMu.Lock()
+	defer configMu.Unlock()
+	fn(&cfg)
+	return writeConfigLocked(cfg.SQIP, cfg.DataDir)
+}
+
+// GetSyncPace returns the pause between preamps during sync.
+func GetSyncPace() time.Duration {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	if cfg.SyncPaceMS == nil {
+		return defaultSyncPace
+	}
+	return time.Duration(*cfg.SyncPaceMS) * time.Millisecond
+}
+
+// GetPhantomSafety returns the phantom switching policy.
+func GetPhantomSafety() phantomSafety {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	if cfg.PhantomSafety == nil {
+		return defaultPhantomSafety
+	}
+	return *cfg.PhantomSafety
+}
+
+// GetUnusedDefaults returns the values unused preamps are reset to.
+func GetUnusedDefaults() preampDefaults {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	if cfg.UnusedDefaults == nil {
+		return preampDefaults{}
+	}
+	return *cfg.UnusedDefaults
+}
+
+// GetArmed reports whether commands may be sent to the mixer.
+func GetArmed() bool {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return cfg.Armed == nil || *cfg.Armed
+}
+
 func GetDataDir() string {
 	configMu.RLock()
 	defer configMu.RUnlock()
@@ -154,7 +224,7 @@ func SaveShow(name string, body []byte) error {
 	if name == "" {
 		name = "show"
 	}
-	return os.WriteFile(filepath.Join(showsDir(), name+".json"), body, 0644)
+	return writeFileAtomic(filepath.Join(showsDir(), name+".json"), body, 0644, false)
 }
 
 func DeleteShow(name string) error {
@@ -0,0 +1,788 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// syncStatus holds progress and result of the background sync.
+var (
+	syncMu         sync.Mutex
+	syncStatus     string             // "idle" | "running"
+	syncCurrent    int                // 0-based index of current preamp step
+	syncTotal      int                // total preamp steps
+	syncLastResult *syncResult        // set when status becomes "idle"
+	syncJob        *syncJobCtl        // running job, nil when idle
+	syncDetail     []preampSyncResult // per-preamp outcome of the running job
+	syncHistory    []*syncResult      // finished jobs, newest last
+)
+
+const syncHistoryMax = 20
+
+const (
+	syncMaxRetries   = 5
+	syncRetryBackoff = 100 * time.Millisecond // multiplied by the attempt number
+)
+
+// syncJobCtl lets a running sync be cancelled or paused; both take effect between preamps. Only a panic
+// (cause errPanicPreempted) stops it in the middle of a preamp, see cancelSync.
+type syncJobCtl struct {
+	id      string
+	cancel  context.CancelCauseFunc // the job's ctx: checked between preamps
+	preempt context.CancelCauseFunc // the step ctx, parent of ctx: stops the preamp being sent
+	paused  bool
+	resume  chan struct{} // closed on resume
+}
+
+type syncResult struct {
+	JobID       string         `json:"job_id,omitempty"`
+	Started     time.Time      `json:"started"`
+	Finished    time.Time      `json:"finished"`
+	Selection   *syncSelection `json:"selection,omitempty"` // nil = whole channel list
+	ResetUnused bool           `json:"reset_unused,omitempty"`
+	Total       int            `json:"total"`
+	Synced      int            `json:"synced,omitempty"`
+	Failed      int            `json:"failed,omitempty"`  // preamps with at least one parameter that failed
+	Skipped     int            `json:"skipped,omitempty"` // delta: parameters not sent because the mixer already had them
+	Cancelled   bool           `json:"cancelled,omitempty"`
+	Untouched   []preampKey    `json:"untouched,omitempty"` // cancelled: preamps not reached
+	Locked      []preampKey    `json:"locked,omitempty"`    // skipped: used by a locked channel
+	Error       string         `json:"error,omitempty"`
+
+	Preamps []preampSyncResult `json:"preamps,omitempty"`
+}
+
+// preampSyncResult is the outcome of one plan step, per parameter.
+type preampSyncResult struct {
+	ChannelID int         `json:"channel_id"`
+	Bus       string      `json:"bus"`
+	Preamp    int         `json:"preampId"`
+	Phantom   paramResult `json:"phantom"`
+	Pad       paramResult `json:"pad"`
+	Gain      paramResult `json:"gain"`
+}
+
+type paramResult struct {
+	Status   string `json:"status"` // "pending" | "ok" | "skipped" | "error"
+	Error    string `json:"error,omitempty"`
+	Attempts int    `json:"attempts,omitempty"`
+}
+
+// syncStep is one preamp of a sync run; a stereo channel contributes two steps.
+type syncStep struct {
+	ChannelID int
+	Bus       string
+	Preamp    int
+	Phantom   bool
+	Pad       bool
+	Gain      float64
+}
+
+// syncOp is one packet of a sync plan, in send order.
+type syncOp struct {
+	Step      int     `json:"step"` // index into the plan; matches "current" in /api/sync/status
+	ChannelID int     `json:"channel_id"`
+	Bus       string  `json:"bus"`
+	Preamp    int     `json:"preampId"`
+	Param     string  `json:"param"`
+	Value     string  `json:"value"`
+	Hex       string  `json:"hex"`
+	Blocked   string  `json:"blocked,omitempty"`  // dry run: why the real run would not send it
+	Override  string  `json:"override,omitempty"` // dry run: a broken limit sent anyway (override_limits)
+	Ramp      *opRamp `json:"ramp,omitempty"`     // dry run: gain sent as 1 dB steps (ramp_ms); hex is the last one
+	packet    []byte
+}
+
+// opRamp describes a ramped gain op in the dry run.
+type opRamp struct {
+	FromDB float64 `json:"from_db"` // last known mixer gain (a jump when unknown)
+	ToDB   float64 `json:"to_db"`
+	Steps  int     `json:"steps"`
+	MS     int     `json:"ms"`
+}
+
+// buildSyncPlan turns the channel list into preamp steps: bus defaults to local, stereo adds the R preamp
+// (unless it equals L), local line inputs are skipped. Both the real run and the dry run use this.
+func buildSyncPlan(channels []ChannelState) []syncStep {
+	var plan []syncStep
+	for _, ch := range channels {
+		bus := ch.PreampBus
+		if bus != "local" && bus != "slink" {
+			bus = "local"
+		}
+		ids := []int{ch.PreampId}
+		if ch.PreampIdR != 0 && ch.PreampIdR != ch.PreampId {
+			ids = append(ids, ch.PreampIdR)
+		}
+		for _, id := range ids {
+			if bus == "local" && isLocalLinePreamp(id) {
+				continue
+			}
+			plan = append(plan, syncStep{ChannelID: ch.ID, Bus: bus, Preamp: id, Phantom: ch.Phantom, Pad: ch.Pad, Gain: ch.Gain})
+		}
+	}
+	return plan
+}
+
+// ops returns the packets for one step: phantom, pad, gain.
+func (s syncStep) ops(step int) []syncOp {
+	op := func(param, value string, pkt []byte) syncOp {
+		return syncOp{Step: step, ChannelID: s.ChannelID, Bus: s.Bus, Preamp: s.Preamp, Param: param, Value: value, Hex: fmt.Sprintf("% X", pkt), packet: pkt}
+	}
+	return []syncOp{
+		op("phantom", boolToOnOff(s.Phantom), buildPhantomBus(s.Bus, s.Preamp, s.Phantom)),
+		op("pad", boolToOnOff(s.Pad), buildPadBus(s.Bus, s.Preamp, s.Pad)),
+		op("gain", fmt.Sprintf("%.0f dB", s.Gain), buildGainBus(s.Bus, s.Preamp, s.Gain)),
+	}
+}
+
+// checkLimits checks the step's value for param against the channel safety limits in the current state.
+func (s syncStep) checkLimits(param string) error {
+	on := s.Phantom
+	if param == "pad" {
+		on = s.Pad
+	}
+	return checkPreampLimits(s.Bus, s.Preamp, param, on, s.Gain)
+}
+
+// cmd wraps the operation for the scheduler; the TX log line is written once it is sent.
+func (op syncOp) cmd(addr string, prio int) mixerCmd {
+	return mixerCmd{
+		Addr: addr, Bus: op.Bus, Preamp: op.Preamp, Param: op.Param, Packet: op.packet, Prio: prio,
+		OnSent: func() { LogTXPreamp(op.Bus, op.Preamp, op.Param, op.Value) },
+	}
+}
+
+// send submits the operation as bulk traffic; with ramp_ms, gain is ramped from the last known mixer value
+// (a jump when that is unknown).
+func (op syncOp) send(ctx context.Context, addr string, req syncRequest) error {
+	cmd := op.cmd(addr, prioBulk)
+	cmd.Origin, cmd.ctx = req.origin, ctx
+	if op.Param != "gain" || req.RampMS <= 0 {
+		return scheduler.Submit(cmd)
+	}
+	f, err := parseFrame(op.packet)
+	if err != nil {
+		return scheduler.Submit(cmd)
+	}
+	from := currentGain(op.Bus, op.Preamp, f.GainDB)
+	return rampGain(cmd, from, f.GainDB, time.Duration(req.RampMS)*time.Millisecond)
+}
+
+// known reports whether the mixer is already known to have this value (see mixerstate.go).
+func (op syncOp) known() bool {
+	f, err := parseFrame(op.packet)
+	return err == nil && mixerHasValue(f)
+}
+
+// dipOp is the gain dip sent before a phantom change under the phantom safety policy.
+func (s syncStep) dipOp(step int, policy phantomSafety) syncOp {
+	pkt := buildGainBus(s.Bus, s.Preamp, policy.GainDB)
+	return syncOp{Step: step, ChannelID: s.ChannelID, Bus: s.Bus, Preamp: s.Preamp, Param: "gain",
+		Value: fmt.Sprintf("%.0f dB (phantom safety)", policy.GainDB), Hex: fmt.Sprintf("% X", pkt), packet: pkt}
+}
+
+// syncSelection limits a sync to part of the channel list; all set criteria must match. Empty = everything.
+type syncSelection struct {
+	ChannelIDs []int  `json:"channel_ids,omitempty"`
+	Bus        string `json:"bus,omitempty"`         // "local" | "slink"
+	PreampFrom int    `json:"preamp_from,omitempty"` // inclusive preamp range on the bus (or on both buses)
+	PreampTo   int    `json:"preamp_to,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+func (sel syncSelection) empty() bool {
+	return len(sel.ChannelIDs) == 0 && sel.Bus == "" && sel.PreampFrom == 0 && sel.PreampTo == 0 && sel.Tag == ""
+}
+
+// preamps is the part of the selection that applies to preamps no channel uses: bus and preamp range.
+func (sel syncSelection) preamps() syncSelection {
+	return syncSelection{Bus: sel.Bus, PreampFrom: sel.PreampFrom, PreampTo: sel.PreampTo}
+}
+
+func (sel syncSelection) validate() error {
+	if sel.Bus != "" && sel.Bus != "local" && sel.Bus != "slink" {
+		return fmt.Errorf("bus must be local or slink")
+	}
+	if sel.PreampFrom < 0 || sel.PreampTo < 0 || (sel.PreampTo != 0 && sel.PreampFrom > sel.PreampTo) {
+		return fmt.Errorf("invalid preamp range %d-%d", sel.PreampFrom, sel.PreampTo)
+	}
+	return nil
+}
+
+// filter keeps the plan steps that match the selection; channels supplies the tags.
+func (sel syncSelection) filter(plan []syncStep, channels []ChannelState) []syncStep {
+	if sel.empty() {
+		return plan
+	}
+	ids := map[int]bool{}
+	for _, id := range sel.ChannelIDs {
+		ids[id] = true
+	}
+	tagged := map[int]bool{}
+	for _, ch := range channels {
+		for _, t := range ch.Tags {
+			if strings.EqualFold(t, sel.Tag) {
+				tagged[ch.ID] = true
+			}
+		}
+	}
+	var out []syncStep
+	for _, s := range plan {
+		if len(ids) > 0 && !ids[s.ChannelID] {
+			continue
+		}
+		if sel.Tag != "" && !tagged[s.ChannelID] {
+			continue
+		}
+		if sel.Bus != "" && s.Bus != sel.Bus {
+			continue
+		}
+		if sel.PreampFrom != 0 && s.Preamp < sel.PreampFrom {
+			continue
+		}
+		if sel.PreampTo != 0 && s.Preamp > sel.PreampTo {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// syncRequest is the optional JSON body of POST /api/sync.
+type syncRequest struct {
+	syncSelection
+	DryRun bool `json:"dry_run"` // return the packet plan instead of sending
+	Delta  bool `json:"delta"`   // only send parameters that differ from the last known mixer values
+	Force  bool `json:"force"`   // full sync even if delta is set, e.g. after a mixer reboot
+
+	ContinueOnError bool `json:"continue_on_error"` // keep going after a failed parameter
+	Retries         int  `json:"retries"`           // extra attempts per parameter (0..5)
+	RampMS          int  `json:"ramp_ms"`           // ramp each gain change over this long instead of jumping
+
+	BypassPhantomSafety bool `json:"bypass_phantom_safety"` // switch phantom directly, ignoring the policy (or ?bypass_phantom_safety=1)
+	ResetUnused         bool `json:"reset_unused"`          // also drive unused preamps to the configured defaults
+	OverrideLimits      bool `json:"override_limits"`       // send values that break channel safety limits (logged)
+
+	origin *auditOrigin // the request that started the job
+}
+
+func (r syncRequest) delta() bool { return r.Delta && !r.Force }
+
+func bindSyncRequest(c *gin.Context) (syncRequest, bool) {
+	var req syncRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return req, false
+		}
+	}
+	if v := c.Query("dry_run"); v == "1" || v == "true" {
+		req.DryRun = true
+	}
+	if bypassPhantomSafety(c) {
+		req.BypassPhantomSafety = true
+	}
+	if err := req.syncSelection.validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return req, false
+	}
+	if req.RampMS < 0 || time.Duration(req.RampMS)*time.Millisecond > maxRampDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("ramp_ms must be 0..%d", maxRampDuration.Milliseconds())})
+		return req, false
+	}
+	if req.Retries < 0 || req.Retries > syncMaxRetries {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("retries must be 0..%d", syncMaxRetries)})
+		return req, false
+	}
+	return req, true
+}
+
+// handlePostSync starts syncing the full backend state to the mixer in the background; returns 202 immediately.
+// With dry_run it returns the ordered packet plan and sends nothing; with reset_unused, preamps no channel
+// uses are driven to the configured defaults after the channels. channel_ids and tag select channels only;
+// bus and the preamp range also apply to the unused preamps.
+func handlePostSync(getAddr func(*gin.Context) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindSyncRequest(c)
+		if !ok {
+			return
+		}
+		channels := GetState()
+		plan := req.filter(buildSyncPlan(channels), channels)
+		if req.ResetUnused {
+			plan = append(plan, req.preamps().filter(buildUnusedPlan(channels, GetUnusedDefaults()), channels)...)
+		}
+		startSync(c, getAddr, plan, req)
+	}
+}
+
+// handlePostResetUnused drives every preamp not referenced by the channel list to the configured defaults,
+// as a sync job (same options, progress and cancel as /api/sync). Only bus and the preamp range select:
+// unused preamps have no channel, so channel_ids and tag are refused.
+func handlePostResetUnused(getAddr func(*gin.Context) (string, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		req, ok := bindSyncRequest(c)
+		if !ok {
+			return
+		}
+		if len(req.ChannelIDs) > 0 || req.Tag != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "channel_ids and tag do not apply to unused preamps; use bus and preamp_from/preamp_to"})
+			return
+		}
+		req.ResetUnused = true
+		channels := GetState()
+		startSync(c, getAddr, req.filter(buildUnusedPlan(channels, GetUnusedDefaults()), channels), req)
+	}
+}
+
+// buildUnusedPlan returns one step per local 1–17 / S-Link 1–40 preamp that no channel uses (ChannelID 0).
+func buildUnusedPlan(channels []ChannelState, def preampDefaults) []syncStep {
+	used := map[preampKey]bool{}
+	for _, k := range referencedPreamps(channels) {
+		used[k] = true
+	}
+	var plan []syncStep
+	for _, k := range allPreamps() {
+		if !used[k] {
+			plan = append(plan, syncStep{Bus: k.Bus, Preamp: k.ID, Phantom: def.Phantom, Pad: def.Pad, Gain: def.Gain})
+		}
+	}
+	return plan
+}
+
+// startSync answers a dry run with the packet plan, or starts plan as the background sync job.
+func startSync(c *gin.Context, getAddr func(*gin.Context) (string, bool), plan []syncStep, req syncRequest) {
+	if req.DryRun {
+		c.JSON(http.StatusOK, dryRunSync(plan, req))
+		return
+	}
+	if !requireArmed(c) {
+		return
+	}
+	addr, ok := getAddr(c)
+	if !ok {
+		return
+	}
+	syncMu.Lock()
+	if syncStatus == "running" {
+		syncMu.Unlock()
+		c.JSON(http.StatusConflict, gin.H{"error": "sync already in progress"})
+		return
+	}
+	stepCtx, preempt := context.WithCancelCause(context.Background())
+	ctx, cancel := context.WithCancelCause(stepCtx)
+	job := &syncJobCtl{id: fmt.Sprintf("%x", time.Now().UnixNano()), cancel: cancel, preempt: preempt}
+	syncJob = job
+	syncTotal = len(plan)
+	syncStatus = "running"
+	syncCurrent = 0
+	syncLastResult = nil
+	syncMu.Unlock()
+
+	req.origin = auditOriginOf(c)
+	go runSyncInBackground(ctx, stepCtx, job.id, addr, plan, req)
+	c.JSON(http.StatusAccepted, gin.H{"started": true, "job_id": job.id})
+}
+
+// dryRunSync lists the operations a real run of plan would send, in order, following the same lock, delta,
+// limit and phantom safety rules. Ops the run would refuse are listed with the reason; without continue_on_error the
+// list ends at the first one, where the run would stop.
+func dryRunSync(plan []syncStep, req syncRequest) gin.H {
+	ops := []syncOp{}
+	skipped := 0
+	policy := GetPhantomSafety()
+	out := gin.H{"dry_run": true, "total": len(plan)}
+	channels := GetState()
+	var locked []preampKey
+steps:
+	for i, s := range plan {
+		if id, ok := lockedChannelFor(channels, s.Bus, s.Preamp); ok {
+			for _, op := range s.ops(i) {
+				op.Blocked = fmt.Sprintf("channel %d is locked", id)
+				ops = append(ops, op)
+			}
+			locked = append(locked, preampKey{s.Bus, s.Preamp})
+			continue
+		}
+		dipped := false
+		for _, op := range s.ops(i) {
+			known := op.known()
+			if op.Param == "gain" && dipped { // the mixer will have the dip gain by then
+				known = math.Round(s.Gain) == policy.GainDB
+			}
+			if req.delta() && known {
+				skipped++
+				continue
+			}
+			if err := s.checkLimits(op.Param); err != nil {
+				if !req.OverrideLimits {
+					op.Blocked = err.Error()
+					ops = append(ops, op)
+					if !req.ContinueOnError {
+						out["error"] = err.Error()
+						break steps
+					}
+					continue
+				}
+				op.Override = err.Error()
+			}
+			if op.Param == "phantom" && policy.Enabled && !req.BypassPhantomSafety &&
+				phantomChanges(s.Bus, s.Preamp, s.Phantom) && needsDip(s.Bus, s.Preamp, policy) {
+				ops = append(ops, s.dipOp(i, policy))
+				dipped = true
+			}
+			if op.Param == "gain" && req.RampMS > 0 {
+				from := currentGain(s.Bus, s.Preamp, s.Gain)
+				if dipped {
+					from = policy.GainDB
+				}
+				if n := rampSteps(from, s.Gain); n > 1 {
+					op.Ramp = &opRamp{FromDB: math.Round(from), ToDB: s.Gain, Steps: n, MS: req.RampMS}
+				}
+			}
+			ops = append(ops, op)
+		}
+	}
+	out["operations"], out["skipped"] = ops, skipped
+	if len(locked) > 0 {
+		out["locked"] = locked
+	}
+	return out
+}
+
+// runSyncInBackground runs plan. ctx is cancelled by any cancel and stops the job between preamps; stepCtx
+// only by a panic, which also stops the preamp being sent.
+func runSyncInBackground(ctx, stepCtx context.Context, jobID string, addr string, plan []syncStep, req syncRequest) {
+	defer func() {
+		syncMu.Lock()
+		syncJob.preempt(nil)
+		syncJob = nil
+		syncDetail = nil
+		syncStatus = "idle"
+		syncMu.Unlock()
+	}()
+
+	detail := make([]preampSyncResult, len(plan))
+	for i, s := range plan {
+		pending := paramResult{Status: "pending"}
+		detail[i] = preampSyncResult{ChannelID: s.ChannelID, Bus: s.Bus, Preamp: s.Preamp, Phantom: pending, Pad: pending, Gain: pending}
+	}
+	syncMu.Lock()
+	syncDetail = detail
+	syncMu.Unlock()
+
+	policy := GetPhantomSafety()
+	if req.BypassPhantomSafety {
+		policy.Enabled = false
+	}
+	res := &syncResult{JobID: jobID, Started: time.Now(), Total: len(plan), ResetUnused: req.ResetUnused}
+	if !req.syncSelection.empty() {
+		sel := req.syncSelection
+		res.Selection = &sel
+	}
+	attempts := 1 + req.Retries
+	// cancelAt stops the job at step i; pending are the started step's operations not sent yet, nil if the
+	// step was not started.
+	cancelAt := func(i int, pending []syncOp) {
+		res.Cancelled = true
+		res.Error = fmt.Sprintf("cancelled after %d of %d preamps", i, len(plan))
+		rest := plan[i:]
+		if pending != nil {
+			rest = plan[i+1:]
+			for _, op := range pending {
+				setSyncParam(i, op.Param, paramResult{Status: "skipped", Error: "cancelled"})
+			}
+		}
+		for _, r := range rest {
+			res.Untouched = append(res.Untouched, preampKey{r.Bus, r.Preamp})
+		}
+	}
+steps:
+	for i, s := range plan {
+		if err := waitSyncRunnable(ctx); err != nil {
+			cancelAt(i, nil)
+			break
+		}
+		syncMu.Lock()
+		syncCurrent = i
+		syncMu.Unlock()
+
+		if id, locked := lockedChannelFor(GetState(), s.Bus, s.Preamp); locked {
+			for _, param := range []string{"phantom", "pad", "gain"} {
+				setSyncParam(i, param, paramResult{Status: "skipped", Error: fmt.Sprintf("channel %d is locked", id)})
+			}
+			res.Locked = append(res.Locked, preampKey{s.Bus, s.Preamp})
+			continue
+		}
+		sentAny, failed, dipped := false, false, false
+		ops := s.ops(i)
+		for j, op := range ops {
+			// A panic pre-empts the job before it switches phantom off: nothing may be sent after that. A user
+			// cancel lets the preamp finish, so it is not left half set.
+			if stepCtx.Err() != nil {
+				if !sentAny {
+					cancelAt(i, nil)
+				} else {
+					cancelAt(i, ops[j:])
+				}
+				break steps
+			}
+			if req.delta() && op.known() {
+				setSyncParam(i, op.Param, paramResult{Status: "skipped"})
+				res.Skipped++
+				continue
+			}
+			if err := s.checkLimits(op.Param); err != nil {
+				if !req.OverrideLimits {
+					setSyncParam(i, op.Param, paramResult{Status: "error", Error: err.Error()})
+					failed = true
+					if !req.ContinueOnError {
+						res.Failed++
+						res.Error = err.Error()
+						break steps
+					}
+					continue
+				}
+				overrideLimit(err)
+			}
+			sentAny = true
+			// Phantom safety: a changing phantom is preceded by a gain dip; the step's own gain op restores
+			// the gain once the settle time has passed.
+			sequence := op.Param == "phantom" && policy.Enabled && phantomChanges(s.Bus, s.Preamp, s.Phantom)
+			sendOp := func() error {
+				if sequence {
+					waitPhantomStagger(policy.stagger())
+					if err := stepCtx.Err(); err != nil {
+						return err
+					}
+					cmd := op.cmd(addr, prioBulk)
+					cmd.Origin, cmd.ctx = req.origin, stepCtx
+					d, err := phantomDip(cmd, policy)
+					if err != nil {
+						return err
+					}
+					dipped = dipped || d
+				}
+				if op.Param == "gain" && dipped {
+					if err := sleepCtx(stepCtx, policy.settle()); err != nil {
+						return err
+					}
+				}
+				return op.send(stepCtx, addr, req)
+			}
+			var err error
+			n := 0
+			for n < attempts && stepCtx.Err() == nil {
+				n++
+				if err = sendOp(); err == nil || !retryable(err) {
+					break
+				}
+				if n < attempts {
+					_ = sleepCtx(stepCtx, time.Duration(n)*syncRetryBackoff)
+				}
+			}
+			if stepCtx.Err() != nil && (err != nil || n == 0) { // not sent
+				cancelAt(i, ops[j:])
+				break steps
+			}
+			if err != nil {
+				setSyncParam(i, op.Param, paramResult{Status: "error", Error: err.Error(), Attempts: n})
+				failed = true
+				if !req.ContinueOnError {
+					res.Failed++
+					res.Error = err.Error()
+					break steps
+				}
+				continue
+			}
+			setSyncParam(i, op.Param, paramResult{Status: "ok", Attempts: n})
+		}
+		if failed {
+			res.Failed++
+		} else {
+			res.Synced++
+		}
+		if sentAny {
+			time.Sleep(GetSyncPace())
+		}
+	}
+	if res.Failed > 0 && res.Error == "" {
+		res.Error = fmt.Sprintf("%d of %d preamps failed", res.Failed, len(plan))
+	}
+
+	syncMu.Lock()
+	res.Finished = time.Now()
+	res.Preamps = append([]preampSyncResult(nil), detail...)
+	syncLastResult = res
+	syncHistory = append(syncHistory, res)
+	if len(syncHistory) > syncHistoryMax {
+		syncHistory = syncHistory[len(syncHistory)-syncHistoryMax:]
+	}
+	syncMu.Unlock()
+}
+
+// setSyncParam records the outcome of one parameter of plan step i.
+func setSyncParam(i int, param string, r paramResult) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	if i >= len(syncDetail) {
+		return
+	}
+	switch param {
+	case "phantom":
+		syncDetail[i].Phantom = r
+	case "pad":
+		syncDetail[i].Pad = r
+	case "gain":
+		syncDetail[i].Gain = r
+	}
+}
+
+// cancelSync cancels the running sync, if any, with cause; returns its job ID. The preamp being sent is
+// finished unless cause is errPanicPreempted.
+func cancelSync(cause error) string {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	if syncJob == nil {
+		return ""
+	}
+	if errors.Is(cause, errPanicPreempted) {
+		syncJob.preempt(cause)
+	} else {
+		syncJob.cancel(cause)
+	}
+	return syncJob.id
+}
+
+// waitSyncIdle waits up to d for the running sync to finish.
+func waitSyncIdle(d time.Duration) bool {
+	deadline := time.Now().Add(d)
+	for {
+		syncMu.Lock()
+		idle := syncJob == nil
+		syncMu.Unlock()
+		if idle {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// retryable reports whether a failed sync op may be sent again: not once a panic, the arm switch, a newer
+// command or a cancel has stopped it.
+func retryable(err error) bool {
+	return !errors.Is(err, errPanicPreempted) && !errors.Is(err, errDisarmed) && !errors.Is(err, errRampCancelled) &&
+		!errors.Is(err, context.Canceled)
+}
+
+// sleepCtx sleeps for d or until ctx is cancelled.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// waitSyncRunnable blocks while the job is paused; returns an error once it is cancelled.
+func waitSyncRunnable(ctx context.Context) error {
+	for {
+		syncMu.Lock()
+		var resume chan struct{}
+		if syncJob != nil && syncJob.paused {
+			resume = syncJob.resume
+		}
+		syncMu.Unlock()
+		if resume == nil {
+			return ctx.Err()
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-resume:
+		}
+	}
+}
+
+// syncJobAction returns a handler for cancel/pause/resume on the running sync. An optional ?id= (or
+// "job_id" in the JSON body) must match the running job, so a stale client cannot stop a newer one.
+func syncJobAction(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Query("id")
+		if id == "" && c.Request.ContentLength > 0 {
+			var body struct {
+				JobID string `json:"job_id"`
+			}
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			id = body.JobID
+		}
+		syncMu.Lock()
+		defer syncMu.Unlock()
+		job := syncJob
+		if job == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "no sync in progress"})
+			return
+		}
+		if id != "" && id != job.id {
+			c.JSON(http.StatusConflict, gin.H{"error": "sync job " + id + " is not running", "job_id": job.id})
+			return
+		}
+		switch action {
+		case "cancel":
+			job.cancel(nil)
+		case "pause":
+			if !job.paused {
+				job.paused = true
+				job.resume = make(chan struct{})
+			}
+		case "resume":
+			if job.paused {
+				job.paused = false
+				close(job.resume)
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"job_id": job.id, "action": action, "paused": job.paused})
+	}
+}
+
+// handleGetSyncHistory lists the last finished sync jobs, newest first.
+func handleGetSyncHistory(c *gin.Context) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	out := make([]*syncResult, 0, len(syncHistory))
+	for i := len(syncHistory) - 1; i >= 0; i-- {
+		out = append(out, syncHistory[i])
+	}
+	c.JSON(http.StatusOK, gin.H{"history": out})
+}
+
+func handleGetSyncStatus(c *gin.Context) {
+	syncMu.Lock()
+	defer syncMu.Unlock()
+	out := gin.H{"status": syncStatus, "current": syncCurrent, "total": syncTotal}
+	if syncJob != nil {
+		out["job_id"] = syncJob.id
+		out["paused"] = syncJob.paused
+		out["preamps"] = syncDetail
+	}
+	if syncLastResult != nil {
+		out["last_result"] = syncLastResult
+	}
+	c.JSON(http.StatusOK, out)
+}
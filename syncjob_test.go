@@ -0,0 +1,264 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestBuildSyncPlan(t *testing.T) {
+	channels := []ChannelState{
+		{ID: 1, PreampBus: "", PreampId: 3, Gain: 20},            // bus defaults to local
+		{ID: 2, PreampBus: "local", PreampId: 18, PreampIdR: 19}, // line input: skipped
+		{ID: 3, PreampBus: "slink", PreampId: 5, PreampIdR: 6},   // stereo: two steps
+		{ID: 4, PreampBus: "slink", PreampId: 7, PreampIdR: 7},   // R == L: one step
+	}
+	plan := buildSyncPlan(channels)
+	want := []struct {
+		ch     int
+		bus    string
+		preamp int
+	}{{1, "local", 3}, {3, "slink", 5}, {3, "slink", 6}, {4, "slink", 7}}
+	if len(plan) != len(want) {
+		t.Fatalf("plan has %d steps, want %d: %+v", len(plan), len(want), plan)
+	}
+	for i, w := range want {
+		if s := plan[i]; s.ChannelID != w.ch || s.Bus != w.bus || s.Preamp != w.preamp {
+			t.Errorf("step %d = %+v, want %+v", i, s, w)
+		}
+	}
+	ops := plan[0].ops(0)
+	if len(ops) != 3 || ops[0].Param != "phantom" || ops[1].Param != "pad" || ops[2].Param != "gain" {
+		t.Fatalf("ops = %+v", ops)
+	}
+	if ops[2].Hex != "F7 0C 0C 0C 02 01 00 94" {
+		t.Errorf("gain hex = %s", ops[2].Hex)
+	}
+}
+
+func TestSyncSelectionFilter(t *testing.T) {
+	channels := []ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 1},
+		{ID: 2, PreampBus: "slink", PreampId: 3, PreampIdR: 4, Tags: []string{"stagebox"}},
+		{ID: 3, PreampBus: "slink", PreampId: 20, Tags: []string{"Stagebox"}},
+	}
+	plan := buildSyncPlan(channels)
+	cases := []struct {
+		name string
+		sel  syncSelection
+		want int
+	}{
+		{"all", syncSelection{}, 4},
+		{"ids", syncSelection{ChannelIDs: []int{1, 3}}, 2},
+		{"bus", syncSelection{Bus: "slink"}, 3},
+		{"range", syncSelection{Bus: "slink", PreampFrom: 4, PreampTo: 10}, 1},
+		{"tag", syncSelection{Tag: "stagebox"}, 3},
+		{"tag and range", syncSelection{Tag: "stagebox", PreampTo: 3}, 1},
+	}
+	for _, tc := range cases {
+		if got := tc.sel.filter(plan, channels); len(got) != tc.want {
+			t.Errorf("%s: %d steps, want %d", tc.name, len(got), tc.want)
+		}
+	}
+}
+
+func TestSyncSelectionUnusedPreamps(t *testing.T) {
+	channels := []ChannelState{{ID: 1, PreampBus: "slink", PreampId: 3, Tags: []string{"stagebox"}}}
+	unused := buildUnusedPlan(channels, preampDefaults{})
+	sel := syncSelection{Tag: "stagebox", Bus: "slink", PreampFrom: 1, PreampTo: 5}
+	if got := sel.filter(unused, channels); len(got) != 0 {
+		t.Fatalf("tag filter kept %d unused steps; it only applies to channels", len(got))
+	}
+	if got := sel.preamps().filter(unused, channels); len(got) != 4 {
+		t.Errorf("bus and range kept %d unused steps, want 4 (S-Link 1, 2, 4, 5)", len(got))
+	}
+}
+
+// syncRouter serves the sync endpoints against the simulator v.
+func syncRouter(v *virtualSQ) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/api/sync", handlePostSync(func(*gin.Context) (string, bool) { return v.Addr(), true }))
+	r.POST("/api/sync/cancel", syncJobAction("cancel"))
+	r.POST("/api/sync/pause", syncJobAction("pause"))
+	r.POST("/api/sync/resume", syncJobAction("resume"))
+	return r
+}
+
+func postJSON(t *testing.T, r *gin.Engine, path, body string, want int) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != want {
+		t.Fatalf("POST %s: %d %s, want %d", path, w.Code, w.Body, want)
+	}
+}
+
+// waitSyncResult waits for the sync job to finish and returns its result.
+func waitSyncResult(t *testing.T) *syncResult {
+	t.Helper()
+	var res *syncResult
+	waitFor(t, func() bool {
+		syncMu.Lock()
+		defer syncMu.Unlock()
+		res = syncLastResult
+		return syncStatus == "idle" && res != nil
+	})
+	return res
+}
+
+// syncTestChannels sets n channels on local preamps 1..n.
+func syncTestChannels(t *testing.T, n int) {
+	t.Helper()
+	var channels []ChannelState
+	for id := 1; id <= n; id++ {
+		channels = append(channels, ChannelState{ID: id, PreampBus: "local", PreampId: id, Gain: 20})
+	}
+	if err := SetStateAndCurrentShow(channels, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSyncPauseResumeCancel(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	useTempDataDir(t)
+	pace := 30
+	setTestConfig(t, func(c *config) { c.SyncPaceMS, c.PhantomSafety = &pace, &phantomSafety{} }) // 3 frames per preamp
+	syncTestChannels(t, 12)
+	frames := watchSim(t, v)
+	r := syncRouter(v)
+	postJSON(t, r, "/api/sync", `{}`, 202)
+	waitFor(t, func() bool { return len(frames()) >= 3 })
+
+	postJSON(t, r, "/api/sync/pause", ``, 200)
+	time.Sleep(100 * time.Millisecond) // the current preamp finishes
+	paused := len(frames())
+	time.Sleep(150 * time.Millisecond)
+	if n := len(frames()); n != paused {
+		t.Fatalf("%d frames sent while paused", n-paused)
+	}
+	postJSON(t, r, "/api/sync/resume", ``, 200)
+	waitFor(t, func() bool { return len(frames()) > paused })
+
+	// Cancel while paused, so it lands between preamps.
+	postJSON(t, r, "/api/sync/pause", ``, 200)
+	time.Sleep(100 * time.Millisecond)
+	postJSON(t, r, "/api/sync/cancel", ``, 200)
+	res := waitSyncResult(t)
+	if !res.Cancelled || len(res.Untouched) == 0 || res.Synced+len(res.Untouched) != 12 {
+		t.Errorf("result: cancelled %v, synced %d, untouched %d", res.Cancelled, res.Synced, len(res.Untouched))
+	}
+	if res.Synced*3 != len(frames()) {
+		t.Errorf("%d frames for %d synced preamps", len(frames()), res.Synced)
+	}
+}
+
+func TestSyncCancelFinishesPreamp(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	useTempDataDir(t)
+	setTestConfig(t, func(c *config) { c.PhantomSafety = &phantomSafety{Enabled: true, SettleMS: 200} })
+	if err := SetStateAndCurrentShow([]ChannelState{
+		{ID: 1, PreampBus: "local", PreampId: 1, Phantom: true, Gain: 20},
+		{ID: 2, PreampBus: "local", PreampId: 2, Phantom: true, Gain: 20},
+	}, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	frames := watchSim(t, v)
+	r := syncRouter(v)
+	postJSON(t, r, "/api/sync", `{}`, 202)
+	// dip, phantom and pad are sent; the gain waits for the settle time.
+	waitFor(t, func() bool { return len(frames()) >= 3 })
+
+	postJSON(t, r, "/api/sync/cancel", ``, 200)
+	res := waitSyncResult(t)
+	if !res.Cancelled || res.Synced != 1 || len(res.Untouched) != 1 {
+		t.Errorf("result: cancelled %v, synced %d, untouched %d, want preamp 1 finished", res.Cancelled, res.Synced, len(res.Untouched))
+	}
+	waitFor(t, func() bool { return len(frames()) >= 4 }) // the cancelled preamp gets its gain back
+	if n := len(frames()); n != 4 {
+		t.Errorf("%d frames, want 4", n)
+	}
+}
+
+func TestSyncContinueOnErrorRetries(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	useTempDataDir(t)
+	syncTestChannels(t, 2)
+	if err := v.SetFaults(simFaults{Refuse: true}); err != nil {
+		t.Fatal(err)
+	}
+	r := syncRouter(v)
+
+	postJSON(t, r, "/api/sync", `{"continue_on_error": true, "retries": 1}`, 202)
+	res := waitSyncResult(t)
+	if res.Failed != 2 || len(res.Preamps) != 2 {
+		t.Fatalf("result = %+v, want both preamps failed", res)
+	}
+	for _, p := range res.Preamps {
+		for _, pr := range []paramResult{p.Phantom, p.Pad, p.Gain} {
+			if pr.Status != "error" || pr.Attempts != 2 {
+				t.Errorf("local %d: %+v, want error after 2 attempts", p.Preamp, pr)
+			}
+		}
+	}
+
+	// Without continue_on_error the job stops at the first failure.
+	postJSON(t, r, "/api/sync", `{}`, 202)
+	res = waitSyncResult(t)
+	if res.Failed != 1 || res.Error == "" || res.Preamps[0].Phantom.Attempts != 1 || res.Preamps[1].Phantom.Status != "pending" {
+		t.Errorf("result = %+v, want a stop after the first failure", res)
+	}
+}
+
+func TestSyncDelta(t *testing.T) {
+	v, _ := startTestSim(t)
+	startSchedulerOnce.Do(scheduler.Start)
+	useTempDataDir(t)
+	pace := 0
+	setTestConfig(t, func(c *config) { c.SyncPaceMS, c.PhantomSafety = &pace, &phantomSafety{} })
+	syncTestChannels(t, 3)
+	frames := watchSim(t, v)
+	r := syncRouter(v)
+	run := func(body string) *syncResult {
+		t.Helper()
+		postJSON(t, r, "/api/sync", body, 202)
+		return waitSyncResult(t)
+	}
+
+	if res := run(`{}`); res.Synced != 3 || res.Skipped != 0 {
+		t.Fatalf("full sync: %+v", res)
+	}
+	waitFor(t, func() bool { return len(frames()) == 9 })
+	if res := run(`{"delta": true}`); res.Skipped != 9 || res.Synced != 3 {
+		t.Errorf("delta sync: skipped %d, synced %d, want 9 and 3", res.Skipped, res.Synced)
+	}
+	if res := run(`{"delta": true, "force": true}`); res.Skipped != 0 {
+		t.Errorf("forced sync skipped %d", res.Skipped)
+	}
+	waitFor(t, func() bool { return len(frames()) >= 18 })
+	if n := len(frames()); n != 18 {
+		t.Fatalf("%d frames, want 18: the delta run sent %d", n, n-18)
+	}
+
+	// A phantom change under the safety policy: the dip leaves the mixer below the wanted gain, so the gain is
+	// sent again even though it had not changed.
+	setTestConfig(t, func(c *config) { c.PhantomSafety = &phantomSafety{Enabled: true, GainDB: 0} })
+	UpdatePhantom("local", 1, true)
+	if res := run(`{"delta": true}`); res.Skipped != 7 {
+		t.Errorf("delta sync after a phantom change: skipped %d, want 7", res.Skipped)
+	}
+	want := []string{"local 1 gain 0 dB", "local 1 phantom on", "local 1 gain 20 dB"}
+	waitFor(t, func() bool { return len(frames()) >= 18+len(want) })
+	if got := frames()[18:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("frames = %q, want %q", got, want)
+	}
+}